@@ -0,0 +1,264 @@
+package rabbit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AckUpTo acknowledges the message along with all the unacknowledged messages
+// delivered before it on the same channel, in a single round trip (ie.
+// basic.ack with multiple set); this considerably reduces the ack traffic of
+// high-volume consumers, eg. acking every 100th message.
+//
+// Delivery tags are per channel, so it only applies to messages of the
+// consumer the message comes from. It requires `ManualAck` (and `AutoAck`
+// disabled), as messages settled by the library would otherwise be acked
+// twice, which the server treats as a channel error; with
+// `ConsumerConcurrency` greater than 1, make sure the earlier messages are
+// done with before acking them.
+func (r *Rabbit) AckUpTo(msg amqp.Delivery) error {
+	if err := r.checkMultiAck(); err != nil {
+		return err
+	}
+
+	r.settled(msg, false)
+
+	return msg.Ack(true)
+}
+
+// NackUpTo is the same as `AckUpTo()` but rejects the messages (ie.
+// basic.nack with multiple set), requeueing them if requeue is set.
+func (r *Rabbit) NackUpTo(msg amqp.Delivery, requeue bool) error {
+	if err := r.checkMultiAck(); err != nil {
+		return err
+	}
+
+	r.settled(msg, requeue)
+
+	return msg.Nack(true, requeue)
+}
+
+func (r *Rabbit) checkMultiAck() error {
+	if r.Options.AutoAck {
+		return errors.New("messages are acknowledged automatically (AutoAck)")
+	}
+
+	if r.Options.AckPolicy != ManualAck {
+		return errors.New("messages are acknowledged by the library (AckPolicy is not ManualAck)")
+	}
+
+	return nil
+}
+
+// ackBatcher coalesces the acks made by the library (see
+// `Options.AckBatchSize`): acks are held per channel and sent with multiple
+// set, up to (but excluding) the earliest delivery still being handled, so
+// that no message is acked before it has been dealt with. A nil ackBatcher
+// settles messages straight away.
+type ackBatcher struct {
+	size     int
+	channels map[amqp.Acknowledger]*ackState
+	stopped  bool
+	log      Logger
+	mutex    *sync.Mutex
+}
+
+// ackState keeps track of the deliveries of a channel.
+type ackState struct {
+	unsettled map[uint64]struct{}
+	acked     []uint64
+}
+
+func newAckBatcher(size int, log Logger) *ackBatcher {
+	if size == 0 {
+		return nil
+	}
+
+	return &ackBatcher{
+		size:     size,
+		channels: make(map[amqp.Acknowledger]*ackState),
+		log:      log,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// track records that the message has been delivered; it must be called in
+// delivery order, before the message is handed over to be handled.
+func (b *ackBatcher) track(msg amqp.Delivery) {
+	if b == nil || msg.Acknowledger == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.stopped {
+		return
+	}
+
+	state, ok := b.channels[msg.Acknowledger]
+	if !ok {
+		state = &ackState{unsettled: make(map[uint64]struct{})}
+		b.channels[msg.Acknowledger] = state
+	}
+
+	state.unsettled[msg.DeliveryTag] = struct{}{}
+}
+
+// ack acknowledges the message, once enough acks have been held (or on the
+// next flush); messages not tracked are acked straight away.
+func (b *ackBatcher) ack(msg amqp.Delivery) error {
+	if b == nil {
+		return msg.Ack(false)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state, ok := b.channels[msg.Acknowledger]
+	if ok {
+		_, ok = state.unsettled[msg.DeliveryTag]
+	}
+
+	if !ok {
+		return msg.Ack(false)
+	}
+
+	delete(state.unsettled, msg.DeliveryTag)
+	state.acked = append(state.acked, msg.DeliveryTag)
+
+	// Once stopped, there won't be another flush
+	if len(state.acked) >= b.size || b.stopped {
+		return b.flushChannel(msg.Acknowledger, state)
+	}
+
+	return nil
+}
+
+// nack rejects the message straight away; it is released only afterwards, so
+// that it is not acked by a flush in the meantime.
+func (b *ackBatcher) nack(msg amqp.Delivery, requeue bool) error {
+	err := msg.Nack(false, requeue)
+
+	if b == nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if state, ok := b.channels[msg.Acknowledger]; ok {
+		delete(state.unsettled, msg.DeliveryTag)
+	}
+
+	return err
+}
+
+// flush sends the acks held for all channels (as far as the deliveries still
+// being handled allow); if stop is set, messages are acked straight away from
+// then on.
+func (b *ackBatcher) flush(stop bool) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for acknowledger, state := range b.channels {
+		if err := b.flushChannel(acknowledger, state); err != nil {
+			b.log.Errorf("unable to flush acks: %s", err)
+		}
+	}
+
+	if stop {
+		b.stopped = true
+	}
+}
+
+// flushAcknowledger sends the acks held for the given channel (as far as the
+// deliveries still being handled allow), eg. before the channel is closed.
+func (b *ackBatcher) flushAcknowledger(acknowledger amqp.Acknowledger) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state, ok := b.channels[acknowledger]
+	if !ok {
+		return
+	}
+
+	if err := b.flushChannel(acknowledger, state); err != nil {
+		b.log.Errorf("unable to flush acks: %s", err)
+	}
+}
+
+// flushChannel acks (with multiple set) the held acks preceding the earliest
+// unsettled delivery of the channel; the mutex must be held. The channel is
+// forgotten if there is nothing left to keep track of, or if the ack fails
+// (in which case the messages are redelivered by the server).
+func (b *ackBatcher) flushChannel(acknowledger amqp.Acknowledger, state *ackState) error {
+	limit := uint64(math.MaxUint64)
+
+	for tag := range state.unsettled {
+		if tag < limit {
+			limit = tag
+		}
+	}
+
+	var upTo uint64
+
+	held := state.acked[:0]
+
+	for _, tag := range state.acked {
+		if tag >= limit {
+			held = append(held, tag)
+			continue
+		}
+
+		if tag > upTo {
+			upTo = tag
+		}
+	}
+
+	state.acked = held
+
+	var err error
+
+	if upTo > 0 {
+		if err = acknowledger.Ack(upTo, true); err != nil {
+			err = fmt.Errorf("unable to ack messages up to delivery tag %d: %w", upTo, connectionError(err))
+		}
+	}
+
+	if err != nil || (len(state.unsettled) == 0 && len(state.acked) == 0) {
+		delete(b.channels, acknowledger)
+	}
+
+	return err
+}
+
+// flushAcks flushes the held acks every `Options.AckBatchInterval` until the
+// library is stopped, at which point they are flushed one last time.
+func (r *Rabbit) flushAcks() {
+	ticker := time.NewTicker(r.Options.AckBatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.acks.flush(false)
+		case <-r.ctx.Done():
+			r.acks.flush(true)
+			return
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// QueueStats holds the message and consumer counts of a queue, as reported
+// by the server.
+type QueueStats struct {
+	// Name of the queue
+	Name string
+
+	// Number of messages ready to be delivered (ie. not awaiting acknowledgement)
+	Messages int
+
+	// Number of consumers subscribed to the queue
+	Consumers int
+}
+
+// PurgeQueue removes all the messages (that are not awaiting acknowledgement)
+// from the given queue and returns how many were removed; if `name` is empty,
+// the configured queue (`Options.QueueName`) is purged.
+func (r *Rabbit) PurgeQueue(ctx context.Context, name string) (int, error) {
+	if name == "" {
+		name = r.Options.QueueName
+	}
+
+	var purged int
+
+	if err := r.withChannel(ctx, func(ch *amqp.Channel) error {
+		var err error
+
+		purged, err = ch.QueuePurge(name, false)
+
+		return err
+	}); err != nil {
+		return 0, fmt.Errorf("unable to purge queue '%s': %w", name, err)
+	}
+
+	return purged, nil
+}
+
+// DeleteQueue deletes the given queue (the configured one if `name` is empty)
+// and returns the number of messages it contained. If `ifUnused` is set, the
+// queue is deleted only if it has no consumers; if `ifEmpty` is set, only if
+// it contains no messages.
+func (r *Rabbit) DeleteQueue(ctx context.Context, name string, ifUnused, ifEmpty bool) (int, error) {
+	if name == "" {
+		name = r.Options.QueueName
+	}
+
+	var purged int
+
+	if err := r.withChannel(ctx, func(ch *amqp.Channel) error {
+		var err error
+
+		purged, err = ch.QueueDelete(name, ifUnused, ifEmpty, false)
+
+		return err
+	}); err != nil {
+		return 0, fmt.Errorf("unable to delete queue '%s': %w", name, err)
+	}
+
+	return purged, nil
+}
+
+// DeleteExchange deletes the given exchange; if `ifUnused` is set, the
+// exchange is deleted only if it has no bindings.
+func (r *Rabbit) DeleteExchange(ctx context.Context, name string, ifUnused bool) error {
+	if err := r.withChannel(ctx, func(ch *amqp.Channel) error {
+		return ch.ExchangeDelete(name, ifUnused, false)
+	}); err != nil {
+		return fmt.Errorf("unable to delete exchange '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// UnbindQueue removes the binding between the given queue (the configured one
+// if `queue` is empty) and exchange for the given binding key.
+func (r *Rabbit) UnbindQueue(ctx context.Context, queue, bindingKey, exchange string) error {
+	if queue == "" {
+		queue = r.Options.QueueName
+	}
+
+	if err := r.withChannel(ctx, func(ch *amqp.Channel) error {
+		return ch.QueueUnbind(queue, bindingKey, exchange, nil)
+	}); err != nil {
+		return fmt.Errorf("unable to unbind queue '%s' from exchange '%s': %w", queue, exchange, err)
+	}
+
+	return nil
+}
+
+// AddBinding binds the configured queue (`Options.QueueName`) to an exchange
+// (declaring the exchange first, if `binding.ExchangeDeclare` is set) and adds
+// the binding to `Options.Bindings`, so that it is preserved on reconnect. In
+// Producer mode, only the exchange is declared.
+func (r *Rabbit) AddBinding(ctx context.Context, binding Binding) error {
+	if binding.ExchangeName == "" {
+		return errors.New("ExchangeName cannot be empty")
+	}
+
+	if binding.ExchangeDeclare && binding.ExchangeType == "" {
+		return errors.New("ExchangeType cannot be empty if ExchangeDeclare set to true")
+	}
+
+	return r.withChannel(ctx, func(ch *amqp.Channel) error {
+		if binding.ExchangeDeclare {
+			if err := ch.ExchangeDeclare(
+				binding.ExchangeName,
+				binding.ExchangeType,
+				binding.ExchangeDurable,
+				binding.ExchangeAutoDelete,
+				false,
+				false,
+				binding.ExchangeArgs,
+			); err != nil {
+				return fmt.Errorf("unable to declare exchange: %w", err)
+			}
+		}
+
+		if r.Options.Mode != Producer {
+			for _, bindingKey := range binding.BindingKeys {
+				if err := ch.QueueBind(
+					r.Options.QueueName,
+					bindingKey,
+					binding.ExchangeName,
+					false,
+					binding.BindingArgs,
+				); err != nil {
+					return fmt.Errorf("unable to bind queue: %w", err)
+				}
+			}
+		}
+
+		r.topologyMutex.Lock()
+		defer r.topologyMutex.Unlock()
+
+		// Rebuilt rather than changed in place, as the caller owns the slice
+		bindings := make([]Binding, 0, len(r.Options.Bindings)+1)
+		merged := false
+
+		// Merge with an existing binding to the same exchange (with the same
+		// arguments), if any
+		for _, existing := range r.Options.Bindings {
+			if !merged && existing.ExchangeName == binding.ExchangeName && reflect.DeepEqual(existing.BindingArgs, binding.BindingArgs) {
+				keys := append([]string(nil), existing.BindingKeys...)
+
+				for _, bindingKey := range binding.BindingKeys {
+					if !containsString(keys, bindingKey) {
+						keys = append(keys, bindingKey)
+					}
+				}
+
+				existing.BindingKeys = keys
+				merged = true
+			}
+
+			bindings = append(bindings, existing)
+		}
+
+		if !merged {
+			bindings = append(bindings, binding)
+		}
+
+		r.Options.Bindings = bindings
+
+		return nil
+	})
+}
+
+// RemoveBinding unbinds the configured queue (`Options.QueueName`) from an
+// exchange for the given binding key and removes the key from
+// `Options.Bindings` (along with the binding, once it has no keys left), so
+// that it is not re-bound on reconnect.
+func (r *Rabbit) RemoveBinding(ctx context.Context, exchange, bindingKey string) error {
+	return r.withChannel(ctx, func(ch *amqp.Channel) error {
+		args, ok := r.bindingArgs(exchange, bindingKey)
+		if !ok {
+			return fmt.Errorf("no binding to exchange '%s' with key '%s'", exchange, bindingKey)
+		}
+
+		// Not holding topologyMutex during the round trip
+		if r.Options.Mode != Producer {
+			if err := ch.QueueUnbind(r.Options.QueueName, bindingKey, exchange, args); err != nil {
+				return fmt.Errorf("unable to unbind queue '%s' from exchange '%s': %w", r.Options.QueueName, exchange, err)
+			}
+		}
+
+		r.topologyMutex.Lock()
+		defer r.topologyMutex.Unlock()
+
+		// Rebuilt rather than changed in place, as the caller owns the slice
+		bindings := make([]Binding, 0, len(r.Options.Bindings))
+		removed := false
+
+		for _, binding := range r.Options.Bindings {
+			if !removed && binding.ExchangeName == exchange && reflect.DeepEqual(binding.BindingArgs, args) && containsString(binding.BindingKeys, bindingKey) {
+				keys := make([]string, 0, len(binding.BindingKeys)-1)
+
+				for _, key := range binding.BindingKeys {
+					if key != bindingKey {
+						keys = append(keys, key)
+					}
+				}
+
+				removed = true
+
+				// Dropped once it has no keys left
+				if len(keys) == 0 {
+					continue
+				}
+
+				binding.BindingKeys = keys
+			}
+
+			bindings = append(bindings, binding)
+		}
+
+		r.Options.Bindings = bindings
+
+		return nil
+	})
+}
+
+// bindingArgs returns the arguments of the binding to the exchange with the
+// given key, if any.
+func (r *Rabbit) bindingArgs(exchange, bindingKey string) (amqp.Table, bool) {
+	r.topologyMutex.Lock()
+	defer r.topologyMutex.Unlock()
+
+	for _, binding := range r.Options.Bindings {
+		if binding.ExchangeName == exchange && containsString(binding.BindingKeys, bindingKey) {
+			return binding.BindingArgs, true
+		}
+	}
+
+	return nil, false
+}
+
+// bindings returns a copy of `Options.Bindings`, which may be changed
+// concurrently via `AddBinding()` and `RemoveBinding()`.
+func (r *Rabbit) bindings() []Binding {
+	r.topologyMutex.Lock()
+	defer r.topologyMutex.Unlock()
+
+	bindings := make([]Binding, len(r.Options.Bindings))
+
+	for i, binding := range r.Options.Bindings {
+		binding.BindingKeys = append([]string(nil), binding.BindingKeys...)
+		bindings[i] = binding
+	}
+
+	return bindings
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// QueueInfo returns the message and consumer counts of the given queue (the
+// configured one if `name` is empty) by means of a passive declare.
+func (r *Rabbit) QueueInfo(ctx context.Context, name string) (QueueStats, error) {
+	if name == "" {
+		name = r.Options.QueueName
+	}
+
+	var stats QueueStats
+
+	if err := r.withChannel(ctx, func(ch *amqp.Channel) error {
+		q, err := ch.QueueDeclarePassive(name, false, false, false, false, nil)
+		if err != nil {
+			return err
+		}
+
+		stats = QueueStats{
+			Name:      q.Name,
+			Messages:  q.Messages,
+			Consumers: q.Consumers,
+		}
+
+		return nil
+	}); err != nil {
+		return QueueStats{}, fmt.Errorf("unable to inspect queue '%s': %w", name, err)
+	}
+
+	return stats, nil
+}
+
+// QueueExists checks whether the given queue exists by means of a passive
+// declare on a throwaway channel.
+func (r *Rabbit) QueueExists(ctx context.Context, name string) (bool, error) {
+	return r.exists(ctx, func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclarePassive(name, false, false, false, false, nil)
+		return err
+	})
+}
+
+// ExchangeExists checks whether the given exchange exists by means of a
+// passive declare on a throwaway channel.
+func (r *Rabbit) ExchangeExists(ctx context.Context, name string) (bool, error) {
+	return r.exists(ctx, func(ch *amqp.Channel) error {
+		// The server does not check the type on passive declares
+		return ch.ExchangeDeclarePassive(name, amqp.ExchangeDirect, false, false, false, false, nil)
+	})
+}
+
+func (r *Rabbit) exists(ctx context.Context, declare func(ch *amqp.Channel) error) (bool, error) {
+	err := r.withChannel(ctx, declare)
+	if err == nil {
+		return true, nil
+	}
+
+	var amqpErr *amqp.Error
+
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unable to perform passive declare: %w", err)
+}
+
+// withChannel runs `f` on a dedicated, short-lived channel so that any
+// channel-level error raised by the server (eg. NOT_FOUND) does not affect
+// the channels used for consuming and publishing.
+func (r *Rabbit) withChannel(ctx context.Context, f func(ch *amqp.Channel) error) error {
+	if r.closed() {
+		return ErrShutdown
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Prevent using the connection while reconnecting
+	r.ProducerRWMutex.RLock()
+	defer r.ProducerRWMutex.RUnlock()
+
+	if r.Conn == nil {
+		return fmt.Errorf("r.Conn is nil - did this get instantiated correctly? bug?: %w", ErrNotConnected)
+	}
+
+	ch, err := r.Conn.Channel()
+	if err != nil {
+		return fmt.Errorf("unable to instantiate channel: %w", connectionError(err))
+	}
+
+	defer func() {
+		// The server may have already closed the channel on error
+		if !ch.IsClosed() {
+			ch.Close()
+		}
+	}()
+
+	return f(ch)
+}
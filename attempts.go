@@ -0,0 +1,91 @@
+package rabbit
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// maxTrackedRequeues bounds the number of requeued messages whose attempts
+// are kept track of in memory.
+const maxTrackedRequeues = 10000
+
+// Attempts returns how many times the message has been delivered, including
+// this delivery; on top of what `DeliveryAttempts()` accounts for, it counts
+// the times the message has been requeued by this instance of the library
+// (eg. as per `NackRequeueOnError`), which classic queues do not keep track
+// of. Requeues are matched by idempotency key (see `IdempotencyKeyHeader`)
+// or, failing that, by `MessageId`, so messages with neither are not counted.
+func (r *Rabbit) Attempts(msg amqp.Delivery) int64 {
+	attempts := DeliveryAttempts(msg)
+
+	// Messages are only ever redelivered after being requeued
+	if !msg.Redelivered {
+		return attempts
+	}
+
+	key := requeueKey(msg)
+	if key == "" {
+		return attempts
+	}
+
+	r.requeuesMutex.Lock()
+	requeues := r.requeues[key]
+	r.requeuesMutex.Unlock()
+
+	if requeues+1 > attempts {
+		attempts = requeues + 1
+	}
+
+	return attempts
+}
+
+// trackRequeue records that the message has been requeued, so that its next
+// delivery is counted as a further attempt.
+func (r *Rabbit) trackRequeue(msg amqp.Delivery) {
+	key := requeueKey(msg)
+	if key == "" {
+		return
+	}
+
+	// The next delivery is one attempt more than this one
+	attempts := r.Attempts(msg)
+
+	r.requeuesMutex.Lock()
+	defer r.requeuesMutex.Unlock()
+
+	if _, ok := r.requeues[key]; !ok && len(r.requeues) >= maxTrackedRequeues {
+		return
+	}
+
+	r.requeues[key] = attempts
+}
+
+// forgetRequeues stops keeping track of the message, once it has been acked
+// or rejected for good.
+func (r *Rabbit) forgetRequeues(msg amqp.Delivery) {
+	key := requeueKey(msg)
+	if key == "" {
+		return
+	}
+
+	r.requeuesMutex.Lock()
+	delete(r.requeues, key)
+	r.requeuesMutex.Unlock()
+}
+
+// settled updates the requeues kept track of, based on how the message has
+// been settled.
+func (r *Rabbit) settled(msg amqp.Delivery, requeue bool) {
+	if requeue {
+		r.trackRequeue(msg)
+	} else {
+		r.forgetRequeues(msg)
+	}
+}
+
+func requeueKey(msg amqp.Delivery) string {
+	if key, ok := msg.Headers[IdempotencyKeyHeader].(string); ok && key != "" {
+		return key
+	}
+
+	return msg.MessageId
+}
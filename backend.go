@@ -0,0 +1,83 @@
+package rabbit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	// BackendAMQP is the default backend, speaking AMQP 0.9.1 via amqp091-go.
+	BackendAMQP = "amqp"
+
+	// BackendStream is the backend speaking the native RabbitMQ Streams
+	// protocol; it is registered by importing the `stream` subpackage.
+	BackendStream = "stream"
+)
+
+// BackendFactory instantiates an alternative implementation of `IRabbit` from
+// the given options.
+type BackendFactory func(opts *Options) (IRabbit, error)
+
+var (
+	backends      = map[string]BackendFactory{}
+	backendsMutex = &sync.RWMutex{}
+)
+
+// RegisterBackend makes a backend available by the given name, so that it
+// can be selected via `Options.Backend`; it is meant to be called from the
+// `init()` function of packages implementing backends (akin to database/sql
+// drivers) and panics if a backend is registered twice.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+
+	if factory == nil {
+		panic("rabbit: RegisterBackend factory is nil")
+	}
+
+	if _, exists := backends[name]; exists || name == BackendAMQP {
+		panic("rabbit: RegisterBackend called twice for backend " + name)
+	}
+
+	backends[name] = factory
+}
+
+// Backends returns the names of the available backends.
+func Backends() []string {
+	backendsMutex.RLock()
+	defer backendsMutex.RUnlock()
+
+	names := []string{BackendAMQP}
+
+	for name := range backends {
+		names = append(names, name)
+	}
+
+	sort.Strings(names[1:])
+
+	return names
+}
+
+// NewClient instantiates the backend selected via `Options.Backend`; if no
+// backend is specified, it is the same as calling `New()`.
+func NewClient(opts *Options) (IRabbit, error) {
+	if opts == nil {
+		return nil, errors.New("Options cannot be nil")
+	}
+
+	if opts.Backend == "" || opts.Backend == BackendAMQP {
+		return New(opts)
+	}
+
+	backendsMutex.RLock()
+	factory, ok := backends[opts.Backend]
+	backendsMutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown backend '%s' (forgotten import?)", opts.Backend)
+	}
+
+	return factory(opts)
+}
@@ -0,0 +1,327 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// BreakerClosed means that messages flow as usual.
+	BreakerClosed BreakerState = 0
+	// BreakerOpen means that messages are held back until the cool-down
+	// period is over.
+	BreakerOpen BreakerState = 1
+	// BreakerHalfOpen means that a single message is let through to find out
+	// whether the failures are over.
+	BreakerHalfOpen BreakerState = 2
+
+	// DefaultBreakerThreshold is the number of consecutive failures opening a
+	// circuit breaker, if none is provided in its options
+	DefaultBreakerThreshold = 5
+
+	// DefaultBreakerCooldown is how long a circuit breaker stays open, if none
+	// is provided in its options
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// BreakerState is the type used to represent the state of a circuit breaker.
+type BreakerState int
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "Closed"
+	case BreakerOpen:
+		return "Open"
+	case BreakerHalfOpen:
+		return "HalfOpen"
+	}
+
+	return "Unknown"
+}
+
+// BreakerOptions configures a circuit breaker: once Threshold consecutive
+// failures occur, the breaker opens for Cooldown, after which a single trial
+// is let through; the breaker closes if it succeeds and opens again otherwise.
+// State changes are emitted as events (see `Events()`).
+type BreakerOptions struct {
+	// Number of consecutive failures opening the breaker;
+	// DefaultBreakerThreshold if unset
+	Threshold int `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+
+	// How long the breaker stays open; DefaultBreakerCooldown if unset
+	Cooldown time.Duration `json:"cooldown,omitempty" yaml:"cooldown,omitempty"`
+
+	// Optional; decides whether an error counts as a failure. If unset, the
+	// consumer breaker counts all errors except those caused by the message
+	// itself (ie. ErrSchemaViolation, ErrInvalidSignature and
+	// ErrPoisonMessage), and the publish breaker counts those telling of an
+	// unhealthy server (ie. ErrNotConnected, ErrPublishTimeout and
+	// ErrPublishNacked)
+	IsFailure func(err error) bool `json:"-" yaml:"-"`
+}
+
+func (o *BreakerOptions) validate(v *ValidationError, prefix string) {
+	if o.Threshold < 0 {
+		v.add(prefix+"Threshold", "cannot be negative")
+	}
+
+	if o.Cooldown < 0 {
+		v.add(prefix+"Cooldown", "cannot be negative")
+	}
+}
+
+func (o *BreakerOptions) applyDefaults() {
+	if o.Threshold == 0 {
+		o.Threshold = DefaultBreakerThreshold
+	}
+
+	if o.Cooldown == 0 {
+		o.Cooldown = DefaultBreakerCooldown
+	}
+}
+
+// breaker implements a circuit breaker; a nil breaker is always closed.
+type breaker struct {
+	name      string
+	opts      *BreakerOptions
+	isFailure func(err error) bool
+	emit      func(event Event)
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	trial     bool
+	changed   chan struct{}
+	mutex     *sync.Mutex
+}
+
+// newBreaker returns a breaker configured as per opts (nil if opts is nil);
+// isFailure is used unless `opts.IsFailure` is set.
+func newBreaker(name string, opts *BreakerOptions, isFailure func(err error) bool, emit func(event Event)) *breaker {
+	if opts == nil {
+		return nil
+	}
+
+	if opts.IsFailure != nil {
+		isFailure = opts.IsFailure
+	}
+
+	return &breaker{
+		name:      name,
+		opts:      opts,
+		isFailure: isFailure,
+		emit:      emit,
+		changed:   make(chan struct{}),
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *breaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkCooldown()
+
+	return b.state
+}
+
+// wait blocks while the breaker is open (or while another trial is in
+// progress); trial is true if the caller has been let through as the trial
+// of the half-open breaker, in which case it must report its outcome via
+// `record()` like everyone else. An error is returned if ctx is done or stop
+// is closed first.
+func (b *breaker) wait(ctx context.Context, stop <-chan struct{}) (trial bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+
+	for {
+		b.mutex.Lock()
+
+		b.checkCooldown()
+
+		var cooldown time.Duration
+
+		switch b.state {
+		case BreakerClosed:
+			b.mutex.Unlock()
+			return false, nil
+		case BreakerHalfOpen:
+			if !b.trial {
+				b.trial = true
+				b.mutex.Unlock()
+
+				return true, nil
+			}
+
+			// Wait for the trial to complete
+			cooldown = b.opts.Cooldown
+		case BreakerOpen:
+			cooldown = b.opts.Cooldown - time.Since(b.openedAt)
+		}
+
+		changed := b.changed
+
+		b.mutex.Unlock()
+
+		timer := time.NewTimer(cooldown)
+
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-stop:
+			timer.Stop()
+			return false, ErrShutdown
+		}
+
+		timer.Stop()
+	}
+}
+
+// allow is the same as `wait()` but fails with an error wrapping
+// ErrCircuitOpen instead of waiting.
+func (b *breaker) allow() (trial bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkCooldown()
+
+	switch b.state {
+	case BreakerClosed:
+		return false, nil
+	case BreakerHalfOpen:
+		if !b.trial {
+			b.trial = true
+			return true, nil
+		}
+	}
+
+	return false, fmt.Errorf("%s breaker: %w", b.name, ErrCircuitOpen)
+}
+
+// record updates the breaker with the outcome of a message let through.
+func (b *breaker) record(err error, trial bool) {
+	if b == nil {
+		return
+	}
+
+	failure := err != nil && b.isFailure(err)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if trial {
+		b.trial = false
+
+		if failure {
+			b.open(err)
+		} else {
+			b.close()
+		}
+
+		return
+	}
+
+	// Outcomes of messages let through before the breaker opened are moot
+	if b.state != BreakerClosed {
+		return
+	}
+
+	if !failure {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+
+	if b.failures >= b.opts.Threshold {
+		b.open(err)
+	}
+}
+
+// cancel gives up the trial (if trial is set) without an outcome, so that
+// another one can be let through.
+func (b *breaker) cancel(trial bool) {
+	if b == nil || !trial {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// checkCooldown moves the breaker to half-open once the cool-down period is
+// over; the mutex must be held.
+func (b *breaker) checkCooldown() {
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.opts.Cooldown {
+		b.transition(BreakerHalfOpen, nil)
+	}
+}
+
+func (b *breaker) open(err error) {
+	b.openedAt = time.Now()
+	b.transition(BreakerOpen, err)
+}
+
+func (b *breaker) close() {
+	b.failures = 0
+	b.transition(BreakerClosed, nil)
+}
+
+// transition changes the state of the breaker and wakes up whoever is
+// waiting on it; the mutex must be held.
+func (b *breaker) transition(state BreakerState, err error) {
+	b.state = state
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+
+	b.emit(Event{Type: EventBreakerStateChanged, Breaker: b.name, BreakerState: state, Err: err})
+}
+
+// consumeFailure tells whether a handler error counts as a failure for the
+// consumer breaker.
+func consumeFailure(err error) bool {
+	return !errors.Is(err, ErrSchemaViolation) && !errors.Is(err, ErrInvalidSignature) &&
+		!errors.Is(err, ErrPoisonMessage)
+}
+
+// publishFailure tells whether a publish error counts as a failure for the
+// publish breaker.
+func publishFailure(err error) bool {
+	return errors.Is(err, ErrNotConnected) || errors.Is(err, ErrPublishTimeout) ||
+		errors.Is(err, ErrPublishNacked)
+}
+
+// ConsumerBreakerState returns the state of the consumer circuit breaker (see
+// `Options.ConsumerBreaker`); always BreakerClosed if it is not configured.
+func (r *Rabbit) ConsumerBreakerState() BreakerState {
+	return r.consumerBreaker.State()
+}
+
+// PublishBreakerState returns the state of the publish circuit breaker (see
+// `Options.PublishBreaker`); always BreakerClosed if it is not configured.
+func (r *Rabbit) PublishBreakerState() BreakerState {
+	return r.publishBreaker.State()
+}
@@ -0,0 +1,118 @@
+package rabbit
+
+import (
+	"errors"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrPublishBufferFull is returned when publishing while disconnected and
+// the publish buffer is full (with the BufferFailWhenFull policy).
+var ErrPublishBufferFull = errors.New("publish buffer is full")
+
+// bufferedPublish is a message published while disconnected.
+type bufferedPublish struct {
+	exchange   string
+	routingKey string
+	publishing amqp.Publishing
+}
+
+// BufferedPublishes returns the number of messages currently buffered while
+// disconnected (see `Options.PublishBufferSize`).
+func (r *Rabbit) BufferedPublishes() int {
+	r.bufferMutex.Lock()
+	defer r.bufferMutex.Unlock()
+
+	return len(r.publishBuffer)
+}
+
+// bufferPublish adds the message to the publish buffer, applying
+// `Options.PublishBufferPolicy` if it is full.
+func (r *Rabbit) bufferPublish(exchange, routingKey string, p amqp.Publishing) error {
+	r.bufferMutex.Lock()
+	defer r.bufferMutex.Unlock()
+
+	if len(r.publishBuffer) >= r.Options.PublishBufferSize {
+		switch r.Options.PublishBufferPolicy {
+		case BufferDropNewest:
+			atomic.AddInt64(&r.droppedPublishes, 1)
+			return nil
+		case BufferDropOldest:
+			atomic.AddInt64(&r.droppedPublishes, 1)
+			r.publishBuffer[0] = nil
+			r.publishBuffer = r.publishBuffer[1:]
+		default:
+			return ErrPublishBufferFull
+		}
+	}
+
+	r.publishBuffer = append(r.publishBuffer, &bufferedPublish{
+		exchange:   exchange,
+		routingKey: routingKey,
+		publishing: p,
+	})
+
+	r.log.Debugf("buffered message for exchange '%s' while disconnected (%d buffered)", exchange, len(r.publishBuffer))
+
+	return nil
+}
+
+// flushPublishBuffer publishes the buffered messages in order; should
+// publishing fail (eg. because the connection went away again), the
+// remaining messages stay buffered until the next reconnect. Messages
+// published while flushing may overtake the buffered ones.
+func (r *Rabbit) flushPublishBuffer() {
+	r.bufferMutex.Lock()
+
+	if r.flushingBuffer {
+		r.bufferMutex.Unlock()
+		return
+	}
+
+	r.flushingBuffer = true
+	r.bufferMutex.Unlock()
+
+	defer func() {
+		r.bufferMutex.Lock()
+		r.flushingBuffer = false
+		r.bufferMutex.Unlock()
+	}()
+
+	for {
+		r.bufferMutex.Lock()
+
+		if len(r.publishBuffer) == 0 {
+			r.bufferMutex.Unlock()
+			return
+		}
+
+		next := r.publishBuffer[0]
+
+		r.bufferMutex.Unlock()
+
+		if err := r.publishBuffered(next); err != nil {
+			r.log.Warnf("unable to publish buffered message: %s; retrying on reconnect", err)
+			return
+		}
+
+		r.bufferMutex.Lock()
+		// Unless dropped meanwhile (see BufferDropOldest)
+		if len(r.publishBuffer) > 0 && r.publishBuffer[0] == next {
+			r.publishBuffer[0] = nil
+			r.publishBuffer = r.publishBuffer[1:]
+		}
+		r.bufferMutex.Unlock()
+	}
+}
+
+func (r *Rabbit) publishBuffered(b *bufferedPublish) error {
+	if err := r.ensureServerChannel(); err != nil {
+		return err
+	}
+
+	r.ProducerRWMutex.RLock()
+	defer r.ProducerRWMutex.RUnlock()
+
+	return r.ProducerServerChannel.PublishWithContext(r.ctx, b.exchange, b.routingKey, false, false, b.publishing)
+}
@@ -0,0 +1,230 @@
+package rabbit
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// ChunkIDHeader is the header identifying the message a chunk is part of
+	// (see `Options.ChunkSize`).
+	ChunkIDHeader = "x-chunk-id"
+
+	// ChunkIndexHeader is the header carrying the (zero-based) position of a
+	// chunk within its message.
+	ChunkIndexHeader = "x-chunk-index"
+
+	// ChunkCountHeader is the header carrying the number of chunks the message
+	// was split into.
+	ChunkCountHeader = "x-chunk-count"
+)
+
+// chunkSet holds the chunks of a message received so far.
+type chunkSet struct {
+	count  int64
+	chunks map[int64]amqp.Delivery
+
+	// Evicts the set once `Options.ChunkTimeout` expires
+	timer *time.Timer
+}
+
+// splitPublishing splits the message into chunks of at most
+// `Options.ChunkSize` bytes, each carrying the same properties along with the
+// chunk headers; messages that fit are returned as is.
+func (r *Rabbit) splitPublishing(p amqp.Publishing) []amqp.Publishing {
+	size := r.Options.ChunkSize
+
+	if size == 0 || len(p.Body) <= size {
+		return []amqp.Publishing{p}
+	}
+
+	id := uuid.NewV4().String()
+	count := (len(p.Body) + size - 1) / size
+
+	chunks := make([]amqp.Publishing, 0, count)
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(p.Body) {
+			end = len(p.Body)
+		}
+
+		headers := amqp.Table{}
+
+		for k, v := range p.Headers {
+			headers[k] = v
+		}
+
+		headers[ChunkIDHeader] = id
+		headers[ChunkIndexHeader] = int64(i)
+		headers[ChunkCountHeader] = int64(count)
+
+		chunk := p
+		chunk.Headers = headers
+		chunk.Body = p.Body[i*size : end]
+
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// handleChunk keeps the chunk until all the chunks of its message have been
+// received, then runs `f` on the reassembled message and settles every chunk
+// based on its outcome.
+func (r *Rabbit) handleChunk(f func(msg amqp.Delivery) error, msg amqp.Delivery) error {
+	chunks, err := r.addChunk(msg)
+	if err != nil {
+		r.settle(msg, err)
+		return err
+	}
+
+	// Still waiting for the rest of the message
+	if chunks == nil {
+		return nil
+	}
+
+	err = r.runHandler(f, reassemble(chunks))
+
+	for _, chunk := range chunks {
+		r.settle(chunk, err)
+	}
+
+	return handled(err)
+}
+
+// addChunk stores the chunk and returns the chunks of its message (in order)
+// once all of them have been received.
+func (r *Rabbit) addChunk(msg amqp.Delivery) ([]amqp.Delivery, error) {
+	id, _ := msg.Headers[ChunkIDHeader].(string)
+	index := headerInt(msg.Headers[ChunkIndexHeader])
+	count := headerInt(msg.Headers[ChunkCountHeader])
+
+	if count <= 0 || index < 0 || index >= count {
+		return nil, fmt.Errorf("invalid chunk %d of %d of message '%s'", index, count, id)
+	}
+
+	r.chunksMutex.Lock()
+	defer r.chunksMutex.Unlock()
+
+	set, ok := r.chunks[id]
+	if !ok {
+		set = &chunkSet{
+			count:  count,
+			chunks: make(map[int64]amqp.Delivery),
+		}
+
+		set.timer = time.AfterFunc(r.Options.ChunkTimeout, func() {
+			r.evictChunks(id, set)
+		})
+
+		r.chunks[id] = set
+	}
+
+	if set.count != count {
+		return nil, fmt.Errorf("chunk count %d of message '%s' does not match %d", count, id, set.count)
+	}
+
+	// Chunks redelivered (eg. after reconnecting) replace the ones received
+	// on the previous channel
+	set.chunks[index] = msg
+
+	if int64(len(set.chunks)) < set.count {
+		return nil, nil
+	}
+
+	set.timer.Stop()
+	delete(r.chunks, id)
+
+	chunks := make([]amqp.Delivery, set.count)
+
+	for i := range chunks {
+		chunks[i] = set.chunks[int64(i)]
+	}
+
+	return chunks, nil
+}
+
+// evictChunks drops the chunks of a message whose other chunks have not been
+// received within `Options.ChunkTimeout`, nacking them (without requeueing)
+// so that they stop taking up prefetch slots.
+func (r *Rabbit) evictChunks(id string, set *chunkSet) {
+	r.chunksMutex.Lock()
+
+	// Completed in the meantime
+	if r.chunks[id] != set {
+		r.chunksMutex.Unlock()
+		return
+	}
+
+	delete(r.chunks, id)
+	r.chunksMutex.Unlock()
+
+	r.log.Warnf("dropping %d of %d chunks of message '%s': the rest were not received within %s",
+		len(set.chunks), set.count, id, r.Options.ChunkTimeout)
+
+	if r.Options.AutoAck {
+		return
+	}
+
+	for _, chunk := range set.chunks {
+		if err := r.acks.nack(chunk, false); err != nil {
+			r.log.Errorf("unable to nack chunk of message '%s': %s", id, err)
+		}
+
+		r.settled(chunk, false)
+	}
+}
+
+// reassemble joins the bodies of the chunks into a single message, carrying
+// the properties of the last chunk without the chunk headers.
+func reassemble(chunks []amqp.Delivery) amqp.Delivery {
+	msg := chunks[len(chunks)-1]
+
+	bodies := make([][]byte, len(chunks))
+
+	for i := range chunks {
+		bodies[i] = chunks[i].Body
+	}
+
+	headers := amqp.Table{}
+
+	for k, v := range msg.Headers {
+		switch k {
+		case ChunkIDHeader, ChunkIndexHeader, ChunkCountHeader:
+		default:
+			headers[k] = v
+		}
+	}
+
+	msg.Headers = headers
+	msg.Body = bytes.Join(bodies, nil)
+
+	return msg
+}
+
+func isChunk(msg amqp.Delivery) bool {
+	_, ok := msg.Headers[ChunkIDHeader].(string)
+	return ok
+}
+
+func headerInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int:
+		return int64(n)
+	}
+
+	return -1
+}
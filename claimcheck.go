@@ -0,0 +1,84 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// ClaimCheckHeader is the header carrying the `BlobStore` reference of a
+	// body that was stored externally rather than sent along with the message.
+	ClaimCheckHeader = "x-claim-check"
+
+	// DefaultClaimCheckThreshold is the size (in bytes) above which bodies are
+	// stored in `Options.BlobStore`, if `Options.ClaimCheckThreshold` is unset.
+	DefaultClaimCheckThreshold = 1024 * 1024
+)
+
+// ErrClaimCheck is passed down the error channel for consumed messages whose
+// body could not be retrieved from `Options.BlobStore` (eg. because the blob
+// expired); such messages are rejected without requeueing (ie. dead-lettered,
+// if the queue is configured to do so), as retrying is unlikely to help.
+var ErrClaimCheck = errors.New("unable to retrieve message body")
+
+// BlobStore stores message bodies too large to be sent through the server
+// (see `Options.BlobStore`), according to the claim-check pattern; blobs are
+// never deleted by the library, so their lifecycle (eg. expiry) is up to the
+// store.
+type BlobStore interface {
+	// Put stores the body and returns the reference to retrieve it by
+	Put(ctx context.Context, body []byte) (string, error)
+
+	// Get returns the body stored under the given reference
+	Get(ctx context.Context, ref string) ([]byte, error)
+}
+
+// ClaimCheck returns the `BlobStore` reference of the message body, if it was
+// stored externally.
+func ClaimCheck(msg amqp.Delivery) (string, bool) {
+	ref, ok := msg.Headers[ClaimCheckHeader].(string)
+	return ref, ok && ref != ""
+}
+
+// checkBody moves the body of the message to `Options.BlobStore` (if set) if
+// it exceeds `Options.ClaimCheckThreshold`, replacing it with a reference.
+func (r *Rabbit) checkBody(ctx context.Context, p *amqp.Publishing) error {
+	if r.Options.BlobStore == nil || len(p.Body) <= r.Options.ClaimCheckThreshold {
+		return nil
+	}
+
+	ref, err := r.Options.BlobStore.Put(ctx, p.Body)
+	if err != nil {
+		return fmt.Errorf("unable to store message body: %w", err)
+	}
+
+	setHeader(p, ClaimCheckHeader, ref)
+	p.Body = nil
+
+	return nil
+}
+
+// resolveBody replaces the body of the message with the one stored in
+// `Options.BlobStore` (if set), if the message carries a reference.
+func (r *Rabbit) resolveBody(ctx context.Context, msg *amqp.Delivery) error {
+	if r.Options.BlobStore == nil {
+		return nil
+	}
+
+	ref, ok := ClaimCheck(*msg)
+	if !ok {
+		return nil
+	}
+
+	body, err := r.Options.BlobStore.Get(ctx, ref)
+	if err != nil {
+		return withSentinel(ErrClaimCheck, fmt.Errorf("reference '%s': %w", ref, err))
+	}
+
+	msg.Body = body
+
+	return nil
+}
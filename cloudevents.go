@@ -0,0 +1,413 @@
+package rabbit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// CloudEventsBinary means that the event attributes are carried in the
+	// message headers (see `CloudEventsHeaderPrefix`) and its data in the body.
+	CloudEventsBinary CloudEventsMode = 0
+	// CloudEventsStructured means that the whole event (attributes and data)
+	// is encoded as JSON in the body (see `CloudEventsContentType`).
+	CloudEventsStructured CloudEventsMode = 1
+
+	// CloudEventsSpecVersion is the version of the CloudEvents specification
+	// events are published with, unless set
+	CloudEventsSpecVersion = "1.0"
+
+	// CloudEventsContentType is the content type of structured events.
+	CloudEventsContentType = "application/cloudevents+json"
+
+	// CloudEventsHeaderPrefix is the prefix of the headers carrying the
+	// attributes of binary events, as per the AMQP protocol binding
+	CloudEventsHeaderPrefix = "cloudEvents:"
+
+	// Prefix used by earlier versions of the AMQP protocol binding
+	legacyCloudEventsHeaderPrefix = "cloudEvents_"
+)
+
+// ErrNotCloudEvent is returned when decoding a message that does not carry a
+// CloudEvent.
+var ErrNotCloudEvent = errors.New("message is not a CloudEvent")
+
+// CloudEventsMode is the type used to represent how CloudEvents are mapped to
+// AMQP messages (see https://github.com/cloudevents/spec/blob/main/cloudevents/bindings/amqp-protocol-binding.md).
+type CloudEventsMode int
+
+// CloudEvent is an event as per the CloudEvents specification, see
+// https://github.com/cloudevents/spec/blob/main/cloudevents/spec.md.
+type CloudEvent struct {
+	// Required; generated on publish if empty
+	ID string
+
+	// Required; identifies the context in which the event happened (URI-reference)
+	Source string
+
+	// CloudEventsSpecVersion if empty
+	SpecVersion string
+
+	// Required; type of the event (eg. "com.example.order.created")
+	Type string
+
+	// Optional content type of Data (eg. "application/json")
+	DataContentType string
+
+	// Optional URI of the schema Data adheres to
+	DataSchema string
+
+	// Optional subject of the event in the context of Source
+	Subject string
+
+	// Optional; when the event happened
+	Time time.Time
+
+	// Optional extension attributes
+	Extensions map[string]interface{}
+
+	// Optional payload
+	Data []byte
+}
+
+// Validate checks that the required attributes are set.
+func (e *CloudEvent) Validate() error {
+	switch {
+	case e.ID == "":
+		return errors.New("ID cannot be empty")
+	case e.Source == "":
+		return errors.New("Source cannot be empty")
+	case e.SpecVersion == "":
+		return errors.New("SpecVersion cannot be empty")
+	case e.Type == "":
+		return errors.New("Type cannot be empty")
+	}
+
+	return nil
+}
+
+// PublishCloudEvent publishes the event to the configured exchange, in binary
+// or structured mode; the ID (if empty) and spec version (if empty) are set
+// on the published event.
+func (r *Rabbit) PublishCloudEvent(ctx context.Context, routingKey string, event CloudEvent, mode CloudEventsMode, opts ...PublishOption) error {
+	if event.ID == "" {
+		event.ID = uuid.NewV4().String()
+	}
+
+	if event.SpecVersion == "" {
+		event.SpecVersion = CloudEventsSpecVersion
+	}
+
+	if err := event.Validate(); err != nil {
+		return fmt.Errorf("invalid CloudEvent: %w", err)
+	}
+
+	var body []byte
+
+	switch mode {
+	case CloudEventsBinary:
+		body = event.Data
+		opts = append(opts, withCloudEventHeaders(event))
+	case CloudEventsStructured:
+		var err error
+
+		if body, err = json.Marshal(structuredEvent(event)); err != nil {
+			return fmt.Errorf("unable to encode CloudEvent: %w", err)
+		}
+
+		opts = append(opts, WithContentType(CloudEventsContentType))
+	default:
+		return fmt.Errorf("invalid CloudEvents mode '%d'", mode)
+	}
+
+	return r.Publish(ctx, routingKey, body, opts...)
+}
+
+// ConsumeCloudEvents is the same as `Consume()` but every delivery is decoded
+// into a CloudEvent (in either mode) before being passed to `f`, along with
+// the original delivery and a context carrying its metadata (see
+// `ConsumeContext()`). Decoding errors (eg. `ErrNotCloudEvent`) are treated
+// like errors returned by `f()`.
+func (r *Rabbit) ConsumeCloudEvents(ctx context.Context, errChan chan *ConsumeError, f func(ctx context.Context, event *CloudEvent, msg amqp.Delivery) error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	r.ConsumeContext(ctx, errChan, func(ctx context.Context, msg amqp.Delivery) error {
+		event, err := CloudEventFromDelivery(msg)
+		if err != nil {
+			return err
+		}
+
+		return f(ctx, event, msg)
+	})
+}
+
+// CloudEventFromDelivery decodes the CloudEvent carried by the message, in
+// structured mode if its content type is `CloudEventsContentType` and in
+// binary mode otherwise.
+func CloudEventFromDelivery(msg amqp.Delivery) (*CloudEvent, error) {
+	mediaType, _, _ := mime.ParseMediaType(msg.ContentType)
+
+	var event *CloudEvent
+	var err error
+
+	if mediaType == CloudEventsContentType {
+		event, err = decodeStructured(msg.Body)
+	} else {
+		event, err = decodeBinary(msg)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := event.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid CloudEvent: %w", err)
+	}
+
+	return event, nil
+}
+
+// withCloudEventHeaders adds the attributes of the event to the message
+// headers (without modifying the ones passed in via `WithHeaders()`) and sets
+// the content type.
+func withCloudEventHeaders(event CloudEvent) PublishOption {
+	return func(p *amqp.Publishing) {
+		headers := make(amqp.Table, len(p.Headers)+len(event.Extensions)+7)
+
+		for k, v := range p.Headers {
+			headers[k] = v
+		}
+
+		for k, v := range event.Extensions {
+			headers[CloudEventsHeaderPrefix+k] = v
+		}
+
+		headers[CloudEventsHeaderPrefix+"id"] = event.ID
+		headers[CloudEventsHeaderPrefix+"source"] = event.Source
+		headers[CloudEventsHeaderPrefix+"specversion"] = event.SpecVersion
+		headers[CloudEventsHeaderPrefix+"type"] = event.Type
+
+		if event.DataSchema != "" {
+			headers[CloudEventsHeaderPrefix+"dataschema"] = event.DataSchema
+		}
+
+		if event.Subject != "" {
+			headers[CloudEventsHeaderPrefix+"subject"] = event.Subject
+		}
+
+		if !event.Time.IsZero() {
+			headers[CloudEventsHeaderPrefix+"time"] = event.Time
+		}
+
+		p.Headers = headers
+		p.ContentType = event.DataContentType
+	}
+}
+
+func decodeBinary(msg amqp.Delivery) (*CloudEvent, error) {
+	event := &CloudEvent{
+		DataContentType: msg.ContentType,
+		Data:            msg.Body,
+	}
+
+	var found bool
+
+	for k, v := range msg.Headers {
+		var name string
+
+		switch {
+		case strings.HasPrefix(k, CloudEventsHeaderPrefix):
+			name = strings.TrimPrefix(k, CloudEventsHeaderPrefix)
+		case strings.HasPrefix(k, legacyCloudEventsHeaderPrefix):
+			name = strings.TrimPrefix(k, legacyCloudEventsHeaderPrefix)
+		default:
+			continue
+		}
+
+		found = true
+
+		if err := event.setAttribute(name, v); err != nil {
+			return nil, err
+		}
+	}
+
+	if !found {
+		return nil, ErrNotCloudEvent
+	}
+
+	return event, nil
+}
+
+func decodeStructured(body []byte) (*CloudEvent, error) {
+	var attributes map[string]json.RawMessage
+
+	if err := json.Unmarshal(body, &attributes); err != nil {
+		return nil, fmt.Errorf("unable to decode CloudEvent: %w", err)
+	}
+
+	event := &CloudEvent{}
+
+	for name, raw := range attributes {
+		switch name {
+		case "data", "data_base64":
+			// Decoded below, once the content type is known
+			continue
+		}
+
+		var v interface{}
+
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("unable to decode CloudEvent attribute '%s': %w", name, err)
+		}
+
+		if err := event.setAttribute(name, v); err != nil {
+			return nil, err
+		}
+	}
+
+	if raw, ok := attributes["data_base64"]; ok {
+		var encoded string
+
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return nil, fmt.Errorf("unable to decode CloudEvent data: %w", err)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode CloudEvent data: %w", err)
+		}
+
+		event.Data = data
+	} else if raw, ok := attributes["data"]; ok {
+		event.Data = raw
+
+		// Non-JSON data is carried as a JSON string
+		var s string
+
+		if !isJSONContentType(event.DataContentType) && json.Unmarshal(raw, &s) == nil {
+			event.Data = []byte(s)
+		}
+	}
+
+	return event, nil
+}
+
+// setAttribute sets the context attribute (or extension) with the given name.
+func (e *CloudEvent) setAttribute(name string, v interface{}) error {
+	if name == "time" {
+		switch t := v.(type) {
+		case time.Time:
+			e.Time = t
+		case string:
+			parsed, err := time.Parse(time.RFC3339Nano, t)
+			if err != nil {
+				return fmt.Errorf("invalid CloudEvent time '%s': %w", t, err)
+			}
+
+			e.Time = parsed
+		default:
+			return fmt.Errorf("invalid CloudEvent time '%v'", v)
+		}
+
+		return nil
+	}
+
+	s, isString := v.(string)
+
+	switch name {
+	case "id":
+		e.ID = s
+	case "source":
+		e.Source = s
+	case "specversion":
+		e.SpecVersion = s
+	case "type":
+		e.Type = s
+	case "datacontenttype":
+		e.DataContentType = s
+	case "dataschema":
+		e.DataSchema = s
+	case "subject":
+		e.Subject = s
+	default:
+		if e.Extensions == nil {
+			e.Extensions = make(map[string]interface{})
+		}
+
+		e.Extensions[name] = v
+
+		return nil
+	}
+
+	if !isString {
+		return fmt.Errorf("invalid CloudEvent attribute '%s': not a string", name)
+	}
+
+	return nil
+}
+
+// structuredEvent returns the JSON representation of the event.
+func structuredEvent(event CloudEvent) map[string]interface{} {
+	structured := make(map[string]interface{}, len(event.Extensions)+9)
+
+	for k, v := range event.Extensions {
+		structured[k] = v
+	}
+
+	structured["id"] = event.ID
+	structured["source"] = event.Source
+	structured["specversion"] = event.SpecVersion
+	structured["type"] = event.Type
+
+	if event.DataContentType != "" {
+		structured["datacontenttype"] = event.DataContentType
+	}
+
+	if event.DataSchema != "" {
+		structured["dataschema"] = event.DataSchema
+	}
+
+	if event.Subject != "" {
+		structured["subject"] = event.Subject
+	}
+
+	if !event.Time.IsZero() {
+		structured["time"] = event.Time.Format(time.RFC3339Nano)
+	}
+
+	if event.Data != nil {
+		if isJSONContentType(event.DataContentType) && json.Valid(event.Data) {
+			structured["data"] = json.RawMessage(event.Data)
+		} else {
+			structured["data_base64"] = base64.StdEncoding.EncodeToString(event.Data)
+		}
+	}
+
+	return structured
+}
+
+// isJSONContentType returns whether the data is JSON, which is assumed if no
+// content type is set.
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
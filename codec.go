@@ -0,0 +1,40 @@
+package rabbit
+
+import (
+	"encoding/json"
+)
+
+// Codec is used for encoding payloads before publishing them and decoding
+// them once consumed; the content type is set on published messages.
+type Codec interface {
+	// ContentType returns the MIME content type of the encoded payloads.
+	ContentType() string
+	// Marshal encodes the given value.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes the given data into the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Validator can be implemented by payloads that need to be checked before
+// being published via `PublishEncoded()` or `PublishJSON()`.
+type Validator interface {
+	Validate() error
+}
+
+// JSONCodec is a Codec that uses the standard library's encoding/json.
+type JSONCodec struct{}
+
+// ContentType returns "application/json".
+func (c JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// Marshal encodes v as JSON.
+func (c JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes the JSON data into v.
+func (c JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,86 @@
+package rabbit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadOptions reads `Options` from a YAML (.yaml, .yml) or JSON (.json) file,
+// picking the format from the file extension, and validates them. Fields are
+// named after their snake_case counterparts (eg. `queue_name`, `bindings`);
+// fields that cannot be expressed in a file (eg. `Log`, `Credentials`,
+// `TLSConfig`) must be set on the returned options before calling `New()`.
+//
+// Durations (eg. `heartbeat`) are given as strings such as "10s" in YAML and
+// as nanoseconds in JSON.
+func LoadOptions(path string) (*Options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read options file: %w", err)
+	}
+
+	opts := &Options{}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, opts); err != nil {
+			return nil, fmt.Errorf("unable to decode YAML options: %w", err)
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(opts); err != nil {
+			return nil, fmt.Errorf("unable to decode JSON options: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported options file extension '%s'", ext)
+	}
+
+	normalizeArgs(opts)
+
+	if err := ValidateOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return opts, nil
+}
+
+// normalizeArgs converts the decoded argument tables into values the server
+// accepts (eg. json.Number into int64, nested maps into amqp.Table).
+func normalizeArgs(opts *Options) {
+	opts.QueueArgs = normalizeTable(opts.QueueArgs)
+	opts.ConsumerArgs = normalizeTable(opts.ConsumerArgs)
+
+	for i := range opts.Bindings {
+		opts.Bindings[i].BindingArgs = normalizeTable(opts.Bindings[i].BindingArgs)
+		opts.Bindings[i].ExchangeArgs = normalizeTable(opts.Bindings[i].ExchangeArgs)
+	}
+
+	if opts.Topology == nil {
+		return
+	}
+
+	for i := range opts.Topology.Exchanges {
+		opts.Topology.Exchanges[i].Args = normalizeTable(opts.Topology.Exchanges[i].Args)
+	}
+
+	for i := range opts.Topology.Queues {
+		opts.Topology.Queues[i].Args = normalizeTable(opts.Topology.Queues[i].Args)
+	}
+
+	for i := range opts.Topology.Bindings {
+		opts.Topology.Bindings[i].Args = normalizeTable(opts.Topology.Bindings[i].Args)
+	}
+}
+
+func normalizeTable(table amqp.Table) amqp.Table {
+	return fromArguments(map[string]interface{}(table))
+}
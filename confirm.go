@@ -0,0 +1,555 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// PublishConfirmed means that the server has taken responsibility for
+	// the message (ie. it has been routed and, if persistent, written to
+	// disk).
+	PublishConfirmed PublishOutcome = 0
+	// PublishReturned means that the message could not be routed to any
+	// queue and has been returned by the server (see `PublishResult.Return`).
+	PublishReturned PublishOutcome = 1
+	// PublishNacked means that the server could not take responsibility for
+	// the message (eg. because of an internal error).
+	PublishNacked PublishOutcome = 2
+	// PublishTimedOut means that ctx expired before the server confirmed (or
+	// rejected) the message; its fate is unknown.
+	PublishTimedOut PublishOutcome = 3
+
+	// PublishSeqHeader is the header mandatory messages published via
+	// `PublishAndWait()` are stamped with, so that returned messages can be
+	// told apart.
+	PublishSeqHeader = "x-publish-seq"
+)
+
+var (
+	// ErrPublishNacked is returned (see `PublishResult.Err()`) when the server
+	// rejects a published message.
+	ErrPublishNacked = errors.New("message has been nacked by the server")
+
+	// ErrTooManyInFlight is returned when publishing while
+	// `Options.MaxInFlightPublishes` messages are awaiting confirmation and
+	// `Options.PublishFailFastWhenMaxInFlight` is set.
+	ErrTooManyInFlight = errors.New("too many messages awaiting confirmation")
+)
+
+// PublishOutcome is the type used to represent the outcome of a publish
+// made via `PublishAndWait()`.
+type PublishOutcome int
+
+// String returns the name of the outcome.
+func (o PublishOutcome) String() string {
+	switch o {
+	case PublishConfirmed:
+		return "Confirmed"
+	case PublishReturned:
+		return "Returned"
+	case PublishNacked:
+		return "Nacked"
+	case PublishTimedOut:
+		return "TimedOut"
+	}
+
+	return "Unknown"
+}
+
+// PublishResult is the outcome of a publish made via `PublishAndWait()`.
+type PublishResult struct {
+	Outcome PublishOutcome
+
+	// The returned message (and why it was returned), if `PublishReturned`
+	Return *amqp.Return
+}
+
+// Err returns nil if the message was confirmed and otherwise an error
+// wrapping `ErrUnroutable`, `ErrPublishNacked` or `ErrPublishTimeout`.
+func (r PublishResult) Err() error {
+	switch r.Outcome {
+	case PublishConfirmed:
+		return nil
+	case PublishReturned:
+		return fmt.Errorf("message returned by the server (%d %s): %w", r.Return.ReplyCode, r.Return.ReplyText, ErrUnroutable)
+	case PublishNacked:
+		return ErrPublishNacked
+	case PublishTimedOut:
+		return ErrPublishTimeout
+	}
+
+	return fmt.Errorf("unknown publish outcome '%d'", r.Outcome)
+}
+
+// confirmPublisher publishes messages on a channel in confirm mode, tracking
+// them by delivery tag until they are confirmed, returned or nacked.
+type confirmPublisher struct {
+	ch           *amqp.Channel
+	pending      map[uint64]*Confirmation
+	closed       bool
+	mutex        *sync.Mutex
+	publishMutex *sync.Mutex
+
+	// Called once the outcome of a publish is known
+	onResolved func(c *Confirmation)
+}
+
+// Confirmation tracks a message published via `PublishAsync()` until the
+// server confirms, returns or nacks it.
+type Confirmation struct {
+	exchange   string
+	routingKey string
+	walID      string
+	trial      bool
+	done       chan struct{}
+	result     PublishResult
+	err        error
+	returns    *amqp.Return
+}
+
+// Done returns a channel that is closed once the outcome of the publish is
+// known.
+func (c *Confirmation) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns nil until `Done()` is closed; after that, it returns nil if the
+// message was confirmed and otherwise an error wrapping `ErrUnroutable`,
+// `ErrPublishNacked` or `ErrNotConnected` (if the channel went away before
+// the outcome was known).
+func (c *Confirmation) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
+
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.result.Err()
+}
+
+// Wait waits for the outcome of the publish; should ctx expire first, the
+// outcome is `PublishTimedOut`. The returned error is set only if the channel
+// went away before the outcome was known.
+func (c *Confirmation) Wait(ctx context.Context) (PublishResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	select {
+	case <-c.done:
+		if c.err != nil {
+			return PublishResult{}, c.err
+		}
+
+		return c.result, nil
+	case <-ctx.Done():
+		return PublishResult{Outcome: PublishTimedOut}, nil
+	}
+}
+
+// PublishAndWait publishes a message via `PublishAsync()` and waits for the
+// server to either confirm, return (ie. the message could not be routed to
+// any queue) or nack it; should ctx expire first, the outcome is
+// `PublishTimedOut`. Use `PublishResult.Err()` to treat any outcome other
+// than `PublishConfirmed` as an error.
+//
+// The returned error is set only if the message could not be published at
+// all, in which case the result should be disregarded.
+func (r *Rabbit) PublishAndWait(ctx context.Context, routingKey string, body []byte, opts ...PublishOption) (PublishResult, error) {
+	confirmation, err := r.PublishAsync(ctx, routingKey, body, opts...)
+	if err != nil {
+		return PublishResult{}, err
+	}
+
+	return confirmation.Wait(ctx)
+}
+
+// PublishAsync publishes a message to the configured exchange as mandatory
+// and on a channel in confirm mode, without waiting for the server to confirm
+// it; the returned `Confirmation` is resolved once the outcome is known. This
+// allows high-throughput producers to pipeline publishes and still verify
+// them.
+//
+// Messages are counted (see `Stats()` and `Options.Metrics`) once their
+// outcome is known.
+func (r *Rabbit) PublishAsync(ctx context.Context, routingKey string, body []byte, opts ...PublishOption) (*Confirmation, error) {
+	if r.closed() {
+		return nil, ErrShutdown
+	}
+
+	if r.Options.Mode == Consumer {
+		return nil, fmt.Errorf("unable to Publish - library is configured in Consumer mode: %w", ErrWrongMode)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	exchange := r.exchange
+
+	trial, err := r.admitPublish(ctx, len(body))
+	if err != nil {
+		r.recordPublish(exchange, routingKey, err)
+		return nil, err
+	}
+
+	confirmation, err := r.publishAsync(ctx, exchange, routingKey, body, trial, opts...)
+	if err != nil {
+		r.publishBreaker.record(err, trial)
+		r.recordPublish(exchange, routingKey, err)
+
+		return nil, err
+	}
+
+	return confirmation, nil
+}
+
+// Flush blocks until the outcome of every message published so far via
+// `PublishAsync()` (or `PublishAndWait()`) is known, so that producers can
+// checkpoint safely (eg. before shutdown or committing); messages published
+// via `Publish()` are not confirmed and thus not waited for.
+//
+// It fails if any of the messages still outstanding when called is not
+// confirmed (the error wraps the first such message's error), or with an
+// error wrapping `ErrPublishTimeout` if ctx expires first.
+func (r *Rabbit) Flush(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	r.confirmMutex.Lock()
+	publisher := r.confirms
+	r.confirmMutex.Unlock()
+
+	if publisher == nil {
+		return nil
+	}
+
+	outstanding := publisher.outstanding()
+
+	var failed int
+	var firstErr error
+
+	for _, confirmation := range outstanding {
+		select {
+		case <-confirmation.Done():
+		case <-ctx.Done():
+			return fmt.Errorf("unable to flush %d outstanding message(s): %w", len(outstanding), withSentinel(ErrPublishTimeout, ctx.Err()))
+		}
+
+		if err := confirmation.Err(); err != nil {
+			failed++
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d outstanding message(s) not confirmed: %w", failed, len(outstanding), firstErr)
+	}
+
+	return nil
+}
+
+// publishAsync publishes the message on the confirm channel; `trial` is
+// whether it is the trial of the half-open publish breaker.
+func (r *Rabbit) publishAsync(ctx context.Context, exchange, routingKey string, body []byte, trial bool, opts ...PublishOption) (*Confirmation, error) {
+	p := r.newPublishing(body, opts...)
+	injectTraceContext(ctx, &p)
+	injectCorrelationID(ctx, &p)
+
+	if err := r.validateSchema(routingKey, p.Headers, p.Type, p.Body); err != nil {
+		return nil, err
+	}
+
+	r.sign(&p)
+
+	if err := r.checkBody(ctx, &p); err != nil {
+		return nil, err
+	}
+
+	var walID string
+
+	if r.Options.WAL != nil {
+		id, err := r.Options.WAL.Append(WALEntry{
+			Exchange:   exchange,
+			RoutingKey: routingKey,
+			Publishing: p,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to write message to WAL: %w", err)
+		}
+
+		walID = id
+	}
+
+	confirmation, err := r.publishConfirmed(ctx, exchange, routingKey, p, walID, trial)
+	if err != nil && walID != "" {
+		// The message was never sent
+		if removeErr := r.Options.WAL.Remove(walID); removeErr != nil {
+			r.log.Errorf("unable to remove message from WAL: %s", removeErr)
+		}
+	}
+
+	return confirmation, err
+}
+
+// publishConfirmed publishes the message on the confirm channel; `walID` is
+// the ID of the message in `Options.WAL` (if any) and `trial` is as per
+// `publishAsync()`.
+func (r *Rabbit) publishConfirmed(ctx context.Context, exchange, routingKey string, p amqp.Publishing, walID string, trial bool) (*Confirmation, error) {
+	if err := r.waitUnblocked(ctx); err != nil {
+		return nil, publishError(err)
+	}
+
+	publisher, err := r.confirmPublisher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up confirm channel: %w", err)
+	}
+
+	if err := r.acquirePublishSlot(ctx); err != nil {
+		return nil, err
+	}
+
+	confirmation, err := publisher.publish(ctx, exchange, routingKey, p, walID, trial)
+	if err != nil {
+		r.releasePublishSlot()
+		return nil, publishError(err)
+	}
+
+	return confirmation, nil
+}
+
+// acquirePublishSlot waits until fewer than `Options.MaxInFlightPublishes`
+// messages are awaiting confirmation (unless unlimited), or fails if
+// `Options.PublishFailFastWhenMaxInFlight` is set; slots are released once
+// the outcome of the publish is known.
+func (r *Rabbit) acquirePublishSlot(ctx context.Context) error {
+	if r.publishSlots == nil {
+		return nil
+	}
+
+	if r.Options.PublishFailFastWhenMaxInFlight {
+		select {
+		case r.publishSlots <- struct{}{}:
+			return nil
+		default:
+			return ErrTooManyInFlight
+		}
+	}
+
+	select {
+	case r.publishSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return withSentinel(ErrTooManyInFlight, withSentinel(ErrPublishTimeout, ctx.Err()))
+	}
+}
+
+func (r *Rabbit) releasePublishSlot() {
+	if r.publishSlots != nil {
+		<-r.publishSlots
+	}
+}
+
+// confirmPublisher returns the publisher used for confirmed publishes,
+// setting up a new one if there is none or if its channel has gone away (eg.
+// on reconnect).
+func (r *Rabbit) confirmPublisher() (*confirmPublisher, error) {
+	r.confirmMutex.Lock()
+	defer r.confirmMutex.Unlock()
+
+	if r.confirms != nil && !r.confirms.ch.IsClosed() {
+		return r.confirms, nil
+	}
+
+	// Prevent using the connection while reconnecting
+	r.ProducerRWMutex.RLock()
+	defer r.ProducerRWMutex.RUnlock()
+
+	ch, err := r.Conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate channel: %w", connectionError(err))
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("unable to put channel in confirm mode: %w", connectionError(err))
+	}
+
+	// Returns must not be buffered: the server sends the return before the
+	// ack, so by the time the ack is received the return has been recorded
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+	r.confirms = &confirmPublisher{
+		ch:           ch,
+		pending:      make(map[uint64]*Confirmation),
+		mutex:        &sync.Mutex{},
+		publishMutex: &sync.Mutex{},
+		onResolved: func(c *Confirmation) {
+			r.settleWAL(c)
+			r.releasePublishSlot()
+			r.publishBreaker.record(c.Err(), c.trial)
+			r.recordPublish(c.exchange, c.routingKey, c.Err())
+		},
+	}
+
+	go r.confirms.watch(returns, confirms)
+
+	return r.confirms, nil
+}
+
+// publish publishes the message as mandatory, stamping it with its delivery
+// tag so that it can be matched if returned.
+func (c *confirmPublisher) publish(ctx context.Context, exchange, routingKey string, p amqp.Publishing, walID string, trial bool) (*Confirmation, error) {
+	// Delivery tags are assigned in publishing order
+	c.publishMutex.Lock()
+	defer c.publishMutex.Unlock()
+
+	seq := c.ch.GetNextPublishSeqNo()
+
+	// Registered before publishing, as the return or confirmation may come
+	// in before the publish returns; `mutex` is not held while publishing,
+	// as the channel may be waiting for watch() to receive a confirmation
+	pending, err := c.register(seq, exchange, routingKey, walID, trial)
+	if err != nil {
+		return nil, err
+	}
+
+	// Headers may have been passed in via WithHeaders(), so don't modify them
+	headers := make(amqp.Table, len(p.Headers)+1)
+
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+
+	headers[PublishSeqHeader] = int64(seq)
+	p.Headers = headers
+
+	if err := c.ch.PublishWithContext(ctx, exchange, routingKey, true, false, p); err != nil {
+		c.mutex.Lock()
+		delete(c.pending, seq)
+		c.mutex.Unlock()
+
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+func (c *confirmPublisher) register(seq uint64, exchange, routingKey, walID string, trial bool) (*Confirmation, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil, fmt.Errorf("confirm channel has been closed: %w", ErrNotConnected)
+	}
+
+	pending := &Confirmation{
+		exchange:   exchange,
+		routingKey: routingKey,
+		walID:      walID,
+		trial:      trial,
+		done:       make(chan struct{}),
+	}
+	c.pending[seq] = pending
+
+	return pending, nil
+}
+
+// outstanding returns the publishes whose outcome is not known yet.
+func (c *confirmPublisher) outstanding() []*Confirmation {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	outstanding := make([]*Confirmation, 0, len(c.pending))
+
+	for _, pending := range c.pending {
+		outstanding = append(outstanding, pending)
+	}
+
+	return outstanding
+}
+
+// watch resolves the pending publishes as returns and confirmations come in,
+// until the channel goes away, at which point the pending publishes are
+// failed.
+func (c *confirmPublisher) watch(returns <-chan amqp.Return, confirms <-chan amqp.Confirmation) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+
+			seq, _ := ret.Headers[PublishSeqHeader].(int64)
+
+			c.mutex.Lock()
+			if pending, ok := c.pending[uint64(seq)]; ok {
+				pending.returns = &ret
+			}
+			c.mutex.Unlock()
+		case confirm, ok := <-confirms:
+			if !ok {
+				c.fail()
+				return
+			}
+
+			c.mutex.Lock()
+			pending, ok := c.pending[confirm.DeliveryTag]
+			delete(c.pending, confirm.DeliveryTag)
+			c.mutex.Unlock()
+
+			if !ok {
+				continue
+			}
+
+			switch {
+			case !confirm.Ack:
+				pending.result = PublishResult{Outcome: PublishNacked}
+			case pending.returns != nil:
+				pending.result = PublishResult{Outcome: PublishReturned, Return: pending.returns}
+			default:
+				pending.result = PublishResult{Outcome: PublishConfirmed}
+			}
+
+			close(pending.done)
+			c.onResolved(pending)
+		}
+	}
+}
+
+func (c *confirmPublisher) fail() {
+	c.mutex.Lock()
+
+	c.closed = true
+
+	failed := make([]*Confirmation, 0, len(c.pending))
+
+	for seq, pending := range c.pending {
+		pending.err = fmt.Errorf("confirm channel closed before the message was confirmed: %w", ErrNotConnected)
+		close(pending.done)
+		delete(c.pending, seq)
+
+		failed = append(failed, pending)
+	}
+
+	c.mutex.Unlock()
+
+	for _, pending := range failed {
+		c.onResolved(pending)
+	}
+}
@@ -0,0 +1,171 @@
+// Package consul discovers RabbitMQ nodes registered as a service in Consul,
+// for use as `rabbit.Options.Discoverer`. Only instances passing their health
+// checks are returned.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/batchcorp/rabbit"
+)
+
+const (
+	// DefaultAddress is the address of the local Consul agent
+	DefaultAddress = "http://127.0.0.1:8500"
+
+	// DefaultTimeout is the timeout of the HTTP client used when none is
+	// provided in the Options
+	DefaultTimeout = 10 * time.Second
+)
+
+var _ rabbit.Discoverer = (*Discoverer)(nil)
+
+// Options determines how the discoverer behaves and should be passed in via
+// `New()`.
+type Options struct {
+	// Required; name of the service the RabbitMQ nodes are registered as
+	Service string
+
+	// Optional; only instances with this tag are returned
+	Tag string
+
+	// Optional; datacenter of the agent if unset
+	Datacenter string
+
+	// Address of the Consul HTTP API; DefaultAddress if unset
+	Address string
+
+	// Optional ACL token
+	Token string
+
+	// Optional; a client with `DefaultTimeout` is used if unset
+	HTTPClient *http.Client
+}
+
+// Discoverer lists the addresses of the healthy instances of a service; it is
+// instantiated via `New()`.
+type Discoverer struct {
+	Options *Options
+}
+
+type serviceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// New is used for instantiating the discoverer.
+func New(opts *Options) (*Discoverer, error) {
+	if err := ValidateOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return &Discoverer{
+		Options: opts,
+	}, nil
+}
+
+// ValidateOptions validates the options and applies defaults.
+func ValidateOptions(opts *Options) error {
+	if opts == nil {
+		return errors.New("Options cannot be nil")
+	}
+
+	if opts.Service == "" {
+		return errors.New("Service cannot be empty")
+	}
+
+	if opts.Address == "" {
+		opts.Address = DefaultAddress
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return nil
+}
+
+// Discover returns the addresses ("host:port") of the instances of the
+// service passing their health checks.
+func (d *Discoverer) Discover(ctx context.Context) ([]string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	query := url.Values{"passing": {"true"}}
+
+	if d.Options.Tag != "" {
+		query.Set("tag", d.Options.Tag)
+	}
+
+	if d.Options.Datacenter != "" {
+		query.Set("dc", d.Options.Datacenter)
+	}
+
+	endpoint := strings.TrimSuffix(d.Options.Address, "/") + "/v1/health/service/" +
+		url.PathEscape(d.Options.Service) + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	if d.Options.Token != "" {
+		req.Header.Set("X-Consul-Token", d.Options.Token)
+	}
+
+	resp, err := d.Options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query service health: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var entries []serviceEntry
+
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	addrs := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		// The service address defaults to the node's
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)))
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no healthy instances found for service '%s'", d.Options.Service)
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,14 @@
+package consul
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestConsulSuite(t *testing.T) {
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Consul Suite")
+}
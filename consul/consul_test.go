@@ -0,0 +1,94 @@
+package consul
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Consul", func() {
+	var (
+		server     *httptest.Server
+		discoverer *Discoverer
+		requests   []*http.Request
+		response   string
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		response = `[
+			{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"","Port":5672}},
+			{"Node":{"Address":"10.0.0.2"},"Service":{"Address":"10.0.1.2","Port":5673}}
+		]`
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req)
+			w.Write([]byte(response))
+		}))
+
+		var err error
+
+		discoverer, err = New(&Options{
+			Service:    "rabbitmq",
+			Tag:        "amqp",
+			Datacenter: "dc1",
+			Address:    server.URL,
+			Token:      "token",
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("New", func() {
+		It("applies defaults", func() {
+			d, err := New(&Options{Service: "rabbitmq"})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(d.Options.Address).To(Equal(DefaultAddress))
+			Expect(d.Options.HTTPClient).ToNot(BeNil())
+		})
+
+		It("errors without a Service", func() {
+			_, err := New(&Options{})
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Service cannot be empty"))
+		})
+	})
+
+	Describe("Discover", func() {
+		It("queries the healthy instances of the service", func() {
+			_, err := discoverer.Discover(nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].URL.Path).To(Equal("/v1/health/service/rabbitmq"))
+			Expect(requests[0].URL.Query().Get("passing")).To(Equal("true"))
+			Expect(requests[0].URL.Query().Get("tag")).To(Equal("amqp"))
+			Expect(requests[0].URL.Query().Get("dc")).To(Equal("dc1"))
+			Expect(requests[0].Header.Get("X-Consul-Token")).To(Equal("token"))
+		})
+
+		It("returns the service addresses, defaulting to the node's", func() {
+			addrs, err := discoverer.Discover(nil)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addrs).To(Equal([]string{"10.0.0.1:5672", "10.0.1.2:5673"}))
+		})
+
+		It("errors if there are no healthy instances", func() {
+			response = `[]`
+
+			_, err := discoverer.Discover(nil)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("no healthy instances"))
+		})
+	})
+})
@@ -0,0 +1,388 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type deliveryKey struct{}
+
+// ConsumeContext is the same as `Consume()` but `f` is also passed a context
+// derived from `ctx`, which is cancelled once `f` returns or the library is
+// stopped (see `Stop()` and `Close()`), whichever comes first; it carries the
+// message (see `DeliveryFromContext()`) along with its W3C trace context and
+// correlation ID (see `ContextFromDelivery()`), so that they are propagated to
+// the messages published with it.
+func (r *Rabbit) ConsumeContext(ctx context.Context, errChan chan *ConsumeError, f func(ctx context.Context, msg amqp.Delivery) error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	r.Consume(ctx, errChan, func(msg amqp.Delivery) error {
+		msgCtx, cancel := context.WithCancel(handlerContext(ctx, msg))
+		defer cancel()
+
+		// So that in-flight handlers stop along with the library
+		go func() {
+			select {
+			case <-r.ctx.Done():
+				cancel()
+			case <-msgCtx.Done():
+			}
+		}()
+
+		return f(msgCtx, msg)
+	})
+}
+
+// DeliveryFromContext returns the message being handled, if `ctx` is (derived
+// from) the context passed to the handler (see `ConsumeContext()`).
+func DeliveryFromContext(ctx context.Context) (amqp.Delivery, bool) {
+	if ctx == nil {
+		return amqp.Delivery{}, false
+	}
+
+	msg, ok := ctx.Value(deliveryKey{}).(amqp.Delivery)
+
+	return msg, ok
+}
+
+// handlerContext returns a copy of `ctx` carrying the metadata of the message.
+func handlerContext(ctx context.Context, msg amqp.Delivery) context.Context {
+	return context.WithValue(ContextFromDelivery(ctx, msg), deliveryKey{}, msg)
+}
+
+// ConsumeTyped is a generic version of `Consume()` where every delivery is
+// decoded into a value of type T (via the given codec) before being passed to
+// `f`, along with the original delivery and a context carrying its metadata
+// (see `ConsumeContext()`).
+//
+// Decoding errors are treated like errors returned by `f()`, ie. they are
+// passed down the error channel (if any). If `codec` is nil, `JSONCodec` is
+// used.
+func ConsumeTyped[T any](r *Rabbit, ctx context.Context, errChan chan *ConsumeError, f func(ctx context.Context, msg T, d amqp.Delivery) error, codec Codec) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	r.ConsumeContext(ctx, errChan, func(ctx context.Context, d amqp.Delivery) error {
+		var msg T
+
+		if err := codec.Unmarshal(d.Body, &msg); err != nil {
+			return fmt.Errorf("unable to decode message: %w", err)
+		}
+
+		return f(ctx, msg, d)
+	})
+}
+
+// PanicError is the error reported when a consumer handler panics and
+// `Options.RecoverPanics` is enabled.
+type PanicError struct {
+	// Value is the value that was passed to panic()
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine that panicked
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("recovered from panic in handler: %v", e.Value)
+}
+
+// handleDelivery runs `f` on the given message and then acks/nacks it as
+// dictated by the configured options; chunks (see `Options.ChunkSize`) are
+// held until their message can be reassembled.
+func (r *Rabbit) handleDelivery(f func(msg amqp.Delivery) error, msg amqp.Delivery) error {
+	if isChunk(msg) {
+		return r.handleChunk(f, msg)
+	}
+
+	err := r.runHandler(f, msg)
+
+	r.settle(msg, err)
+
+	return handled(err)
+}
+
+// handled returns the error to report for a settled message; duplicates (see
+// `ErrDuplicate`) are not errors.
+func handled(err error) error {
+	if errors.Is(err, ErrDuplicate) {
+		return nil
+	}
+
+	return err
+}
+
+// admitDelivery holds the message back while the consumer circuit breaker is
+// open (see `Options.ConsumerBreaker`), as per `Options.ConsumeRateLimit` and
+// until fewer than `Options.MaxInFlight` messages are being handled; trial is
+// as per `breaker.wait()`. If the consumer is stopped in the meantime, the
+// message is requeued and ok is false; otherwise `releaseHandlerSlot()` must
+// be called once the message has been handled.
+func (r *Rabbit) admitDelivery(ctx context.Context, msg amqp.Delivery) (trial bool, ok bool) {
+	trial, err := r.consumerBreaker.wait(ctx, r.ctx.Done())
+	if err == nil {
+		err = waitLimiter(ctx, r.ctx.Done(), r.consumeLimiter, 1)
+
+		if err == nil {
+			err = r.acquireHandlerSlot(ctx)
+		}
+
+		if err != nil {
+			r.consumerBreaker.cancel(trial)
+		}
+	}
+
+	if err == nil {
+		return trial, true
+	}
+
+	if !r.Options.AutoAck {
+		if nackErr := r.acks.nack(msg, true); nackErr != nil {
+			r.log.Errorf("unable to requeue message held back by the consumer: %s", nackErr)
+		}
+	}
+
+	return false, false
+}
+
+// acquireHandlerSlot waits until fewer than `Options.MaxInFlight` messages
+// are being handled (unless unlimited).
+func (r *Rabbit) acquireHandlerSlot(ctx context.Context) error {
+	if r.handlerSlots == nil {
+		return nil
+	}
+
+	select {
+	case r.handlerSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.ctx.Done():
+		return ErrShutdown
+	}
+}
+
+func (r *Rabbit) releaseHandlerSlot() {
+	if r.handlerSlots != nil {
+		<-r.handlerSlots
+	}
+}
+
+// runHandler executes `f` on the given message (with its body retrieved from
+// `Options.BlobStore`, if stored there) once its delivery attempts, signature
+// and schema have been verified; if panic recovery is enabled, a panicking
+// handler is turned into a `*PanicError`.
+func (r *Rabbit) runHandler(f func(msg amqp.Delivery) error, msg amqp.Delivery) (err error) {
+	start := time.Now()
+
+	defer func() {
+		atomic.AddInt64(&r.consumed, 1)
+
+		if handled(err) != nil {
+			atomic.AddInt64(&r.handlerErrors, 1)
+		}
+	}()
+
+	if r.Options.Metrics != nil {
+		// Deferred first, so it runs after recovering from panics
+		defer func() {
+			r.Options.Metrics.MessageConsumed(msg, time.Since(start), err)
+		}()
+	}
+
+	if err := r.checkPoison(msg); err != nil {
+		return err
+	}
+
+	if err := r.resolveBody(r.ctx, &msg); err != nil {
+		return err
+	}
+
+	if err := r.verify(msg); err != nil {
+		return err
+	}
+
+	if err := r.validateSchema(msg.RoutingKey, msg.Headers, msg.Type, msg.Body); err != nil {
+		return err
+	}
+
+	if !r.Options.RecoverPanics {
+		return f(msg)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = &PanicError{
+				Value: p,
+				Stack: debug.Stack(),
+			}
+
+			r.log.Errorf("recovered from panic in handler: %v", p)
+		}
+	}()
+
+	return f(msg)
+}
+
+// settle acknowledges the message based on the outcome of its handler, the
+// configured `AckPolicy` and the panic recovery options; it is a no-op if
+// `AutoAck` is enabled.
+func (r *Rabbit) settle(msg amqp.Delivery, err error) {
+	if r.Options.AutoAck {
+		return
+	}
+
+	// The handler was not run, as the message was processed already
+	if errors.Is(err, ErrDuplicate) {
+		if ackErr := r.acks.ack(msg); ackErr != nil {
+			r.log.Errorf("unable to ack duplicate message: %s", ackErr)
+		}
+
+		r.settled(msg, false)
+
+		return
+	}
+
+	// The handler was not run, but the message has been parked
+	if errors.Is(err, ErrPoisonMessage) && r.Options.ParkingQueue != "" {
+		if ackErr := r.acks.ack(msg); ackErr != nil {
+			r.log.Errorf("unable to ack parked message: %s", ackErr)
+		}
+
+		r.settled(msg, false)
+
+		return
+	}
+
+	// The handler was not run, so the message must not be acked
+	if errors.Is(err, ErrInvalidSignature) || errors.Is(err, ErrSchemaViolation) || errors.Is(err, ErrPoisonMessage) || errors.Is(err, ErrClaimCheck) {
+		if nackErr := r.acks.nack(msg, false); nackErr != nil {
+			r.log.Errorf("unable to reject invalid message: %s", nackErr)
+		}
+
+		r.settled(msg, false)
+
+		return
+	}
+
+	var panicErr *PanicError
+
+	if r.Options.NackOnPanic && errors.As(err, &panicErr) {
+		if nackErr := r.acks.nack(msg, r.Options.RequeueOnPanic); nackErr != nil {
+			r.log.Errorf("unable to nack message after panic: %s", nackErr)
+		}
+
+		r.settled(msg, r.Options.RequeueOnPanic)
+
+		return
+	}
+
+	var settleErr error
+
+	switch r.Options.AckPolicy {
+	case ManualAck:
+		return
+	case AckOnSuccess:
+		if err == nil {
+			settleErr = r.acks.ack(msg)
+			r.settled(msg, false)
+		}
+	case NackRequeueOnError, NackDropOnError:
+		if err == nil {
+			settleErr = r.acks.ack(msg)
+			r.settled(msg, false)
+		} else {
+			requeue := r.Options.AckPolicy == NackRequeueOnError && r.Options.RetryPolicy.Retryable(err)
+			settleErr = r.acks.nack(msg, requeue)
+			r.settled(msg, requeue)
+		}
+	}
+
+	if settleErr != nil {
+		r.log.Errorf("unable to settle message: %s", settleErr)
+	}
+}
+
+// newWorkerPool starts `Options.ConsumerConcurrency` workers running `run` on
+// the messages passed to the returned dispatch func; drain stops accepting
+// messages and waits for the in-flight ones to be processed.
+//
+// If `Options.ConsumerKeyOrdering` is set, each worker gets its own queue and
+// messages are assigned to workers by hashing their ordering key, so messages
+// sharing a key are processed sequentially, in order.
+func (r *Rabbit) newWorkerPool(run func(msg amqp.Delivery)) (dispatch func(msg amqp.Delivery), drain func()) {
+	n := r.Options.ConsumerConcurrency
+	queues := make([]chan amqp.Delivery, 1)
+
+	if r.Options.ConsumerKeyOrdering {
+		queues = make([]chan amqp.Delivery, n)
+	}
+
+	for i := range queues {
+		queues[i] = make(chan amqp.Delivery)
+	}
+
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func(work chan amqp.Delivery) {
+			defer wg.Done()
+
+			for msg := range work {
+				run(msg)
+			}
+		}(queues[i%len(queues)])
+	}
+
+	dispatch = func(msg amqp.Delivery) {
+		if len(queues) == 1 {
+			queues[0] <- msg
+			return
+		}
+
+		h := fnv.New32a()
+		h.Write([]byte(r.orderingKey(msg)))
+
+		queues[h.Sum32()%uint32(len(queues))] <- msg
+	}
+
+	drain = func() {
+		for _, work := range queues {
+			close(work)
+		}
+
+		wg.Wait()
+		r.log.Debug("consumer workers drained")
+	}
+
+	return dispatch, drain
+}
+
+// orderingKey returns the key used to assign the message to a worker.
+func (r *Rabbit) orderingKey(msg amqp.Delivery) string {
+	if r.Options.ConsumerOrderingHeader != "" {
+		if v, ok := msg.Headers[r.Options.ConsumerOrderingHeader]; ok {
+			return fmt.Sprintf("%v", v)
+		}
+	}
+
+	return msg.RoutingKey
+}
@@ -0,0 +1,447 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ConsumerConfig overrides, for a single consumer, the consumer-related
+// settings otherwise taken from `Options`; see `ConsumeWithConfig()`.
+type ConsumerConfig struct {
+	// Queue to consume from; `Options.QueueName` if empty
+	QueueName string
+
+	// Used for identifying consumer; derived from `Options.ConsumerTag` if empty
+	ConsumerTag string
+
+	// Arguments used when subscribing the consumer; `Options.ConsumerArgs` if nil
+	Args amqp.Table
+
+	// QoS applied to the consumer's channel; `Options.QosPrefetchCount`,
+	// `Options.QosPrefetchSize` and `Options.QosGlobal` if nil
+	Qos *Qos
+}
+
+// Qos holds the prefetch settings of a channel; see
+// https://pkg.go.dev/github.com/rabbitmq/amqp091-go#Channel.Qos
+type Qos struct {
+	PrefetchCount int
+	PrefetchSize  int
+	Global        bool
+}
+
+// ConsumeWithConfig is the same as `Consume()` but subscribes a dedicated
+// consumer (on its own channel), configured via `cfg` instead of `Options`;
+// this allows running several consumers with different settings on the same
+// `Rabbit` instance.
+//
+// Should the channel go away (eg. on reconnect) or the server cancel the
+// consumer (in which case `ErrConsumerCancelled` is passed down `errChan`), the
+// consumer re-subscribes automatically; an error is returned only if the
+// initial subscription fails.
+func (r *Rabbit) ConsumeWithConfig(ctx context.Context, cfg *ConsumerConfig, errChan chan *ConsumeError, f func(msg amqp.Delivery) error) error {
+	return r.consumeDedicated(ctx, r.consumerConfig(cfg), errChan, func(msg amqp.Delivery) error {
+		return r.handleDelivery(f, msg)
+	})
+}
+
+// consumerConfig returns a copy of the given config, with defaults applied.
+func (r *Rabbit) consumerConfig(cfg *ConsumerConfig) *ConsumerConfig {
+	c := ConsumerConfig{}
+
+	if cfg != nil {
+		c = *cfg
+	}
+
+	if c.QueueName == "" {
+		c.QueueName = r.Options.QueueName
+	}
+
+	if c.ConsumerTag == "" {
+		c.ConsumerTag = r.Options.ConsumerTag + "-" + uuid.NewV4().String()[0:8]
+	}
+
+	if c.Args == nil {
+		c.Args = r.Options.ConsumerArgs
+	}
+
+	if c.Qos == nil {
+		c.Qos = &Qos{
+			PrefetchCount: r.qosPrefetchCount(),
+			PrefetchSize:  r.Options.QosPrefetchSize,
+			Global:        r.Options.QosGlobal,
+		}
+	} else {
+		// SetPrefetch() changes it, which must not affect the caller's
+		qos := *c.Qos
+		c.Qos = &qos
+	}
+
+	return &c
+}
+
+// ConsumerHandle controls a single consumer started via `StartConsumer()`,
+// independently of the other consumers running on the same `Rabbit` instance.
+type ConsumerHandle struct {
+	tag    string
+	cancel func()
+	done   chan struct{}
+}
+
+// Tag returns the consumer tag of the consumer.
+func (h *ConsumerHandle) Tag() string {
+	return h.tag
+}
+
+// Stop stops the consumer and waits for it to exit; other consumers are left
+// running. It is safe to call Stop more than once.
+func (h *ConsumerHandle) Stop() {
+	h.cancel()
+	<-h.done
+}
+
+// Done returns a channel that is closed once the consumer has exited (either
+// via `Stop()`, its context or `Rabbit.Stop()`).
+func (h *ConsumerHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// StartConsumer is the same as `ConsumeWithConfig()` but runs the consumer in
+// the background and returns a handle that can be used for stopping it.
+func (r *Rabbit) StartConsumer(ctx context.Context, cfg *ConsumerConfig, errChan chan *ConsumeError, f func(msg amqp.Delivery) error) (*ConsumerHandle, error) {
+	if err := r.checkConsume(); err != nil {
+		return nil, err
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cfg = r.consumerConfig(cfg)
+
+	sub, err := r.subscribe(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to subscribe consumer: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	h := &ConsumerHandle{
+		tag:    cfg.ConsumerTag,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(h.done)
+
+		r.runConsumer(ctx, cfg, sub, errChan, func(msg amqp.Delivery) error {
+			return r.handleDelivery(f, msg)
+		})
+	}()
+
+	return h, nil
+}
+
+// checkConsume returns an error if the library cannot be used for consuming.
+func (r *Rabbit) checkConsume() error {
+	if r.closed() {
+		return ErrShutdown
+	}
+
+	if r.Options.Mode == Producer {
+		return fmt.Errorf("unable to consume - library is configured in Producer mode: %w", ErrWrongMode)
+	}
+
+	return nil
+}
+
+// consumeDedicated subscribes a consumer on a dedicated channel and runs
+// `handle` (which is expected to settle the message) on every delivery, until
+// stopped via `ctx` or `Stop()`; `handle` may alter `cfg` to change how the
+// consumer re-subscribes.
+func (r *Rabbit) consumeDedicated(ctx context.Context, cfg *ConsumerConfig, errChan chan *ConsumeError, handle func(msg amqp.Delivery) error) error {
+	if err := r.checkConsume(); err != nil {
+		return err
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	sub, err := r.subscribe(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to subscribe consumer: %w", err)
+	}
+
+	r.runConsumer(ctx, cfg, sub, errChan, handle)
+
+	return nil
+}
+
+// runConsumer runs the delivery loop of a subscribed dedicated consumer.
+func (r *Rabbit) runConsumer(ctx context.Context, cfg *ConsumerConfig, sub *subscription, errChan chan *ConsumeError, handle func(msg amqp.Delivery) error) {
+	var err error
+
+	r.trackConsumer(cfg, sub.ch)
+	defer r.untrackConsumer(cfg)
+
+	// In case it exits before being drained
+	defer r.drainedConsumer(cfg)
+
+	r.log.Debugf("consumer '%s' waiting for messages from rabbit ...", cfg.ConsumerTag)
+
+	for {
+		select {
+		case msg, ok := <-sub.deliveries:
+			if !ok {
+				r.log.Warnf("consumer '%s' channel closed; re-subscribing", cfg.ConsumerTag)
+
+				// The server notifies cancellations before closing the deliveries
+				select {
+				case <-sub.cancels:
+					r.emit(Event{Type: EventConsumerCancelled, ConsumerTag: cfg.ConsumerTag})
+					r.writeError(errChan, newConsumeError(cfg.QueueName, cfg.ConsumerTag, nil, ErrConsumerCancelled))
+				default:
+				}
+
+				// Cancelled by StopDrain(); wait for Stop() instead of re-subscribing
+				if atomic.LoadInt32(&r.draining) == 1 {
+					r.drainedConsumer(cfg)
+
+					select {
+					case <-ctx.Done():
+					case <-r.ctx.Done():
+					}
+
+					r.acks.flushAcknowledger(sub.ch)
+					sub.ch.Close()
+					return
+				}
+
+				// The channel may still be open if only the consumer was
+				// cancelled; the deliveries are drained (and handled) by now
+				r.acks.flushAcknowledger(sub.ch)
+				sub.ch.Close()
+
+				if sub, err = r.resubscribe(ctx, cfg); err != nil {
+					// Only returns an error if stopped
+					return
+				}
+
+				r.trackConsumer(cfg, sub.ch)
+
+				continue
+			}
+
+			r.acks.track(msg)
+
+			trial, ok := r.admitDelivery(ctx, msg)
+			if !ok {
+				continue
+			}
+
+			// Counted before the message is settled (and possibly requeued)
+			attempts := r.Attempts(msg)
+
+			r.startHandling(msg)
+			err := handle(msg)
+			r.finishHandling(msg)
+
+			r.releaseHandlerSlot()
+			r.consumerBreaker.record(err, trial)
+
+			if err != nil {
+				r.log.Debugf("error during consume: %s", err)
+
+				consumeErr := newConsumeError(cfg.QueueName, cfg.ConsumerTag, &msg, err)
+				consumeErr.Attempt = int(attempts)
+
+				r.writeError(errChan, consumeErr)
+			}
+		case <-ctx.Done():
+			r.log.Warn("stopped via context")
+			r.acks.flushAcknowledger(sub.ch)
+			sub.ch.Close()
+			return
+		case <-r.ctx.Done():
+			r.log.Warn("stopped via Stop()")
+			r.acks.flushAcknowledger(sub.ch)
+			sub.ch.Close()
+			return
+		}
+	}
+}
+
+// subscription is a consumer subscribed on a dedicated channel.
+type subscription struct {
+	ch         *amqp.Channel
+	deliveries <-chan amqp.Delivery
+
+	// Receives the consumer tag if the consumer is cancelled by the server
+	cancels <-chan string
+}
+
+// subscribe opens a dedicated channel and subscribes the consumer on it.
+func (r *Rabbit) subscribe(cfg *ConsumerConfig) (*subscription, error) {
+	// Prevent using the connection while reconnecting
+	r.ProducerRWMutex.RLock()
+	defer r.ProducerRWMutex.RUnlock()
+
+	ch, err := r.Conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate channel: %w", connectionError(err))
+	}
+
+	// The QoS may be changed at runtime via SetPrefetch()
+	r.consumersMutex.Lock()
+	qos := *cfg.Qos
+	r.consumersMutex.Unlock()
+
+	if err := ch.Qos(qos.PrefetchCount, qos.PrefetchSize, qos.Global); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("unable to set qos policy: %w", err)
+	}
+
+	cancels := ch.NotifyCancel(make(chan string, 1))
+
+	deliveries, err := ch.Consume(
+		cfg.QueueName,
+		cfg.ConsumerTag,
+		r.Options.AutoAck,
+		r.Options.QueueExclusive,
+		false,
+		false,
+		cfg.Args,
+	)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("unable to create delivery channel: %w", err)
+	}
+
+	return &subscription{
+		ch:         ch,
+		deliveries: deliveries,
+		cancels:    cancels,
+	}, nil
+}
+
+// resubscribe keeps attempting to subscribe the consumer until it succeeds or
+// the consumer is stopped.
+func (r *Rabbit) resubscribe(ctx context.Context, cfg *ConsumerConfig) (*subscription, error) {
+	for {
+		sub, err := r.subscribe(cfg)
+		if err == nil {
+			return sub, nil
+		}
+
+		r.log.Warnf("unable to re-subscribe consumer '%s': %s; retrying", cfg.ConsumerTag, err)
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-r.ctx.Done():
+			return nil, r.ctx.Err()
+		}
+	}
+}
+
+// trackConsumer records the channel currently used by a dedicated consumer.
+func (r *Rabbit) trackConsumer(cfg *ConsumerConfig, ch *amqp.Channel) {
+	r.consumersMutex.Lock()
+	defer r.consumersMutex.Unlock()
+
+	r.consumers[cfg] = ch
+}
+
+func (r *Rabbit) untrackConsumer(cfg *ConsumerConfig) {
+	r.consumersMutex.Lock()
+	defer r.consumersMutex.Unlock()
+
+	delete(r.consumers, cfg)
+}
+
+// SetPrefetch changes the prefetch count of all live consumers; as RabbitMQ
+// applies a (non-global) `basic.qos` to new consumers only, consumers are
+// re-subscribed with the new value (the messages they have prefetched are
+// still handed over to the handlers). The new value is retained across
+// reconnects (and overrides the one set via `ConsumerConfig.Qos`); with
+// `Options.AdaptivePrefetch`, it is the starting point of further adjustments.
+func (r *Rabbit) SetPrefetch(ctx context.Context, count int) error {
+	if r.closed() {
+		return ErrShutdown
+	}
+
+	if count < 0 {
+		return errors.New("prefetch count cannot be negative")
+	}
+
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	atomic.StoreInt64(&r.prefetchCount, int64(count))
+
+	if r.Options.Mode != Producer {
+		if err := r.resubscribeMain(); err != nil {
+			return fmt.Errorf("unable to set prefetch on consumer channel: %w", err)
+		}
+	}
+
+	// Prevent using channels while reconnecting
+	r.ProducerRWMutex.RLock()
+	defer r.ProducerRWMutex.RUnlock()
+
+	r.consumersMutex.Lock()
+	defer r.consumersMutex.Unlock()
+
+	for cfg, ch := range r.consumers {
+		cfg.Qos.PrefetchCount = count
+
+		// consumeDedicated() re-subscribes (with the new QoS) once cancelled
+		if err := ch.Cancel(cfg.ConsumerTag, false); err != nil {
+			return fmt.Errorf("unable to set prefetch on consumer '%s': %w", cfg.ConsumerTag, err)
+		}
+	}
+
+	return nil
+}
+
+// resubscribeMain re-subscribes the consumer used by `Consume()` & co. with
+// the current QoS settings, on a new channel (which publishers then use as
+// well); the previous channel is retired (see `retireConsumer()`).
+func (r *Rabbit) resubscribeMain() error {
+	r.ConsumerRWMutex.Lock()
+	defer r.ConsumerRWMutex.Unlock()
+
+	r.ProducerRWMutex.Lock()
+	defer r.ProducerRWMutex.Unlock()
+
+	previous, deliveries := r.ProducerServerChannel, r.ConsumerDeliveryChannel
+	if previous == nil {
+		return nil
+	}
+
+	// The prefetched messages keep coming on the previous deliveries until
+	// they are closed
+	if err := previous.Cancel(r.Options.ConsumerTag, false); err != nil {
+		return fmt.Errorf("unable to cancel consumer: %w", err)
+	}
+
+	if err := r.newConsumerChannel(); err != nil {
+		return err
+	}
+
+	r.retireConsumer(previous, deliveries)
+
+	return nil
+}
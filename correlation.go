@@ -0,0 +1,44 @@
+package rabbit
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type correlationIDKey struct{}
+
+// ContextWithCorrelationID returns a copy of `ctx` carrying the given
+// correlation ID, which is then stamped on the messages published with it
+// (unless set via `WithCorrelationID()`); an empty ID is ignored.
+func ContextWithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	if correlationID == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// CorrelationIDFromContext returns the correlation ID carried by `ctx`, if any
+// (see `ContextWithCorrelationID()` and `ContextFromDelivery()`).
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	correlationID, ok := ctx.Value(correlationIDKey{}).(string)
+
+	return correlationID, ok
+}
+
+// injectCorrelationID stamps the correlation ID carried by `ctx` on the
+// message, unless the message already has one.
+func injectCorrelationID(ctx context.Context, p *amqp.Publishing) {
+	if p.CorrelationId != "" {
+		return
+	}
+
+	if correlationID, ok := CorrelationIDFromContext(ctx); ok {
+		p.CorrelationId = correlationID
+	}
+}
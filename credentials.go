@@ -0,0 +1,184 @@
+package rabbit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// DefaultTokenExpiryMargin is how long before their expiry tokens are
+	// refreshed by `OAuth2ClientCredentials`
+	DefaultTokenExpiryMargin = 30 * time.Second
+)
+
+// CredentialsProvider provides the credentials used for authenticating with
+// the server; it is queried every time the library (re)connects, overriding
+// the credentials embedded in the URLs.
+type CredentialsProvider interface {
+	// Credentials returns the username and password to use; with RabbitMQ's
+	// OAuth2 plugin, the password is the access token (JWT)
+	Credentials(ctx context.Context) (username, password string, err error)
+}
+
+// OAuth2ClientCredentials is a `CredentialsProvider` which obtains access
+// tokens from an OAuth2 token endpoint via the client credentials grant, for
+// use with RabbitMQ's OAuth2 plugin. Tokens are cached and refreshed shortly
+// before they expire.
+type OAuth2ClientCredentials struct {
+	// Required; URL of the token endpoint
+	TokenURL string
+
+	// Required
+	ClientID     string
+	ClientSecret string
+
+	// Optional scopes to request (eg. "rabbitmq.read:*/*")
+	Scopes []string
+
+	// Optional username passed to the server along with the token (which is
+	// ignored by the OAuth2 plugin); ClientID if unset
+	Username string
+
+	// How long before its expiry a token is refreshed; DefaultTokenExpiryMargin
+	// if unset
+	ExpiryMargin time.Duration
+
+	// Optional HTTP client used for requesting tokens; http.DefaultClient if unset
+	HTTPClient *http.Client
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Credentials returns the cached access token (as password), requesting a new
+// one if there is none or it is about to expire.
+func (o *OAuth2ClientCredentials) Credentials(ctx context.Context) (string, string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	username := o.Username
+	if username == "" {
+		username = o.ClientID
+	}
+
+	margin := o.ExpiryMargin
+	if margin == 0 {
+		margin = DefaultTokenExpiryMargin
+	}
+
+	if o.token != "" && (o.expiry.IsZero() || time.Now().Add(margin).Before(o.expiry)) {
+		return username, o.token, nil
+	}
+
+	token, expiry, err := o.requestToken(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to request access token: %w", err)
+	}
+
+	o.token, o.expiry = token, expiry
+
+	return username, token, nil
+}
+
+func (o *OAuth2ClientCredentials) requestToken(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {o.ClientID},
+		"client_secret": {o.ClientSecret},
+	}
+
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := o.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("token endpoint returned no access token")
+	}
+
+	// Tokens without an expiry are cached forever
+	var expiry time.Time
+
+	if token.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	return token.AccessToken, expiry, nil
+}
+
+// credentials returns the SASL mechanisms used when connecting, or nil if the
+// credentials embedded in the URL are to be used.
+func credentials(opts *Options) ([]amqp.Authentication, error) {
+	var username, password string
+	var err error
+
+	switch {
+	case opts.CredentialsProvider != nil:
+		username, password, err = opts.CredentialsProvider.Credentials(context.Background())
+	case opts.Credentials != nil:
+		username, password, err = opts.Credentials()
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get credentials: %w", err)
+	}
+
+	return []amqp.Authentication{&amqp.PlainAuth{
+		Username: username,
+		Password: password,
+	}}, nil
+}
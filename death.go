@@ -0,0 +1,159 @@
+package rabbit
+
+import (
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Death is an entry of the x-death header the server adds to messages every
+// time they are dead-lettered (eg. rejected, expired or dropped from a full
+// queue); see `Deaths()`.
+type Death struct {
+	// Queue the message was dead-lettered from
+	Queue string
+
+	// Reason is one of "rejected", "expired", "maxlen" or "delivery_limit"
+	Reason string
+
+	// Count is how many times the message was dead-lettered from Queue for
+	// Reason
+	Count int64
+
+	// Exchange and RoutingKeys the message was published with (before being
+	// dead-lettered from Queue)
+	Exchange    string
+	RoutingKeys []string
+
+	// Time the message was (first) dead-lettered from Queue for Reason
+	Time time.Time
+
+	// OriginalExpiration is the per-message TTL the message had, if any
+	OriginalExpiration string
+}
+
+// Deaths parses the x-death header of the message, most recent death first;
+// it returns nil if the message was never dead-lettered.
+func Deaths(msg amqp.Delivery) []Death {
+	entries, ok := msg.Headers["x-death"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	deaths := make([]Death, 0, len(entries))
+
+	for _, entry := range entries {
+		table, ok := entry.(amqp.Table)
+		if !ok {
+			continue
+		}
+
+		death := Death{
+			Count: headerInt(table["count"]),
+		}
+
+		death.Queue, _ = table["queue"].(string)
+		death.Reason, _ = table["reason"].(string)
+		death.Exchange, _ = table["exchange"].(string)
+		death.Time, _ = table["time"].(time.Time)
+		death.OriginalExpiration, _ = table["original-expiration"].(string)
+
+		if keys, ok := table["routing-keys"].([]interface{}); ok {
+			for _, key := range keys {
+				if s, ok := key.(string); ok {
+					death.RoutingKeys = append(death.RoutingKeys, s)
+				}
+			}
+		}
+
+		deaths = append(deaths, death)
+	}
+
+	return deaths
+}
+
+// DeathCount returns how many times the message has been dead-lettered after
+// failed deliveries (ie. for the "rejected" or "delivery_limit" reasons),
+// across all queues; messages expiring (eg. those delayed via
+// `PublishAfter()`) or dropped from a full queue were never handled, so those
+// deaths are not counted.
+func DeathCount(msg amqp.Delivery) int64 {
+	var count int64
+
+	for _, death := range Deaths(msg) {
+		switch death.Reason {
+		case "rejected", "delivery_limit":
+			count += death.Count
+		}
+	}
+
+	return count
+}
+
+// DeliveryAttempts returns how many times the message has been delivered,
+// including this delivery, based on the retries made by the library (see
+// `RetryCountHeader`), the failed deliveries in its dead-lettering history
+// (see `DeathCount()`) and the delivery count of quorum queues
+// (x-delivery-count), whichever is highest.
+//
+// Messages requeued on classic queues are not counted, as the server does not
+// keep track of them; see `Rabbit.Attempts()` for those requeued by the
+// library.
+func DeliveryAttempts(msg amqp.Delivery) int64 {
+	attempts := RetryCount(msg)
+
+	if count := DeathCount(msg); count > attempts {
+		attempts = count
+	}
+
+	if count := deliveryCount(msg); count > attempts {
+		attempts = count
+	}
+
+	return attempts + 1
+}
+
+// OriginalDestination returns the exchange and routing key the message was
+// published with before being first dead-lettered; ok is false if it never
+// was.
+func OriginalDestination(msg amqp.Delivery) (exchange, routingKey string, ok bool) {
+	first, ok := firstDeath(msg)
+	if !ok {
+		return "", "", false
+	}
+
+	if len(first.RoutingKeys) > 0 {
+		routingKey = first.RoutingKeys[0]
+	}
+
+	return first.Exchange, routingKey, true
+}
+
+// FirstDeathReason returns why the message was first dead-lettered (see
+// `Death.Reason`), or an empty string if it never was.
+func FirstDeathReason(msg amqp.Delivery) string {
+	first, _ := firstDeath(msg)
+	return first.Reason
+}
+
+// firstDeath returns the x-death entry of the first time the message was
+// dead-lettered; entries are moved to the front as the message keeps dying,
+// so it is looked up via the x-first-death-* headers set by the server.
+func firstDeath(msg amqp.Delivery) (Death, bool) {
+	deaths := Deaths(msg)
+	if len(deaths) == 0 {
+		return Death{}, false
+	}
+
+	queue, _ := msg.Headers["x-first-death-queue"].(string)
+	reason, _ := msg.Headers["x-first-death-reason"].(string)
+
+	for _, death := range deaths {
+		if death.Queue == queue && death.Reason == reason {
+			return death, true
+		}
+	}
+
+	// Oldest entry, if the headers are missing
+	return deaths[len(deaths)-1], true
+}
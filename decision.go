@@ -0,0 +1,246 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// Ack means that the message should be acknowledged.
+	Ack Decision = 0
+	// NackRequeue means that the message should be rejected and requeued.
+	NackRequeue Decision = 1
+	// NackDiscard means that the message should be rejected and dropped (or
+	// dead-lettered, if the queue is configured to do so).
+	NackDiscard Decision = 2
+	// Retry means that the message should be republished to the tail of the
+	// queue (after the delay set by `Options.RetryPolicy`, if any), with its
+	// retry counter (`RetryCountHeader`) incremented, and the original
+	// delivery acknowledged.
+	Retry Decision = 3
+
+	// RetryCountHeader is the header used by the library to keep track of how
+	// many times a message has been retried via the `Retry` decision.
+	RetryCountHeader = "x-retry-count"
+)
+
+// Decision is the type returned by decision handlers (see `ConsumeDecision()`)
+// to tell the library how to acknowledge the message.
+type Decision int
+
+// String returns the name of the decision.
+func (d Decision) String() string {
+	switch d {
+	case Ack:
+		return "Ack"
+	case NackRequeue:
+		return "NackRequeue"
+	case NackDiscard:
+		return "NackDiscard"
+	case Retry:
+		return "Retry"
+	}
+
+	return "Unknown"
+}
+
+// ConsumeDecision is the same as `Consume()` but the handler returns a
+// `Decision` which the library enacts (ie. the message is acked, nacked or
+// retried accordingly); handlers must not ack messages themselves.
+//
+// Errors that occur while enacting the decision are passed down the error
+// channel. `AckPolicy` is ignored, as the decision always prevails; as
+// decisions cannot be enacted on messages acknowledged automatically, it
+// returns straight away if the library is configured with `AutoAck`.
+func (r *Rabbit) ConsumeDecision(ctx context.Context, errChan chan *ConsumeError, f func(msg amqp.Delivery) Decision) {
+	if r.Options.AutoAck {
+		r.log.Error("unable to ConsumeDecision() - messages are acknowledged automatically (AutoAck)")
+		return
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	r.consume(ctx, errChan, func(msg amqp.Delivery) error {
+		return r.handleDecision(ctx, f, msg)
+	})
+}
+
+// handleDecision runs the decision handler on the given message (once all its
+// chunks have been received, if it was chunked) and enacts the returned
+// decision on every delivery the message spans; panics (if recovered) are
+// settled as per the panic recovery options.
+func (r *Rabbit) handleDecision(ctx context.Context, f func(msg amqp.Delivery) Decision, msg amqp.Delivery) error {
+	deliveries := []amqp.Delivery{msg}
+
+	if isChunk(msg) {
+		chunks, err := r.addChunk(msg)
+		if err != nil {
+			r.settle(msg, err)
+			return err
+		}
+
+		// Still waiting for the rest of the message
+		if chunks == nil {
+			return nil
+		}
+
+		deliveries, msg = chunks, reassemble(chunks)
+	}
+
+	var decision Decision
+
+	if err := r.runHandler(func(msg amqp.Delivery) error {
+		decision = f(msg)
+		return nil
+	}, msg); err != nil {
+		for _, d := range deliveries {
+			r.settle(d, err)
+		}
+
+		return err
+	}
+
+	// Waited for once, however many deliveries the message spans
+	if decision == Retry && !r.Options.RetryPolicy.expired(msg) {
+		if err := r.waitRetry(ctx, msg); err != nil {
+			for _, d := range deliveries {
+				// Don't lose the message
+				if nackErr := r.acks.nack(d, true); nackErr != nil {
+					r.log.Errorf("unable to nack message after interrupted retry: %s", nackErr)
+				}
+
+				r.settled(d, true)
+			}
+
+			return fmt.Errorf("retry interrupted: %w", err)
+		}
+	}
+
+	var enactErr error
+
+	for _, d := range deliveries {
+		if err := r.enact(ctx, d, decision); err != nil && enactErr == nil {
+			enactErr = err
+		}
+	}
+
+	return enactErr
+}
+
+// enact settles the message according to the given decision; for `Retry`, the
+// retry delay must have been waited for already.
+func (r *Rabbit) enact(ctx context.Context, msg amqp.Delivery, decision Decision) error {
+	switch decision {
+	case Ack:
+		r.settled(msg, false)
+		return r.acks.ack(msg)
+	case NackRequeue:
+		r.settled(msg, true)
+		return r.acks.nack(msg, true)
+	case NackDiscard:
+		r.settled(msg, false)
+		return r.acks.nack(msg, false)
+	case Retry:
+		if r.Options.RetryPolicy.expired(msg) {
+			if nackErr := r.acks.nack(msg, false); nackErr != nil {
+				r.log.Errorf("unable to nack message after retrying for too long: %s", nackErr)
+			}
+
+			r.settled(msg, false)
+
+			return ErrRetryTimeExceeded
+		}
+
+		if err := r.retry(ctx, msg); err != nil {
+			// Don't lose the message
+			if nackErr := r.acks.nack(msg, true); nackErr != nil {
+				r.log.Errorf("unable to nack message after failed retry: %s", nackErr)
+			}
+
+			r.settled(msg, true)
+
+			return fmt.Errorf("unable to retry message: %w", err)
+		}
+
+		// The retry counter takes over from here
+		r.settled(msg, false)
+
+		return r.acks.ack(msg)
+	}
+
+	return fmt.Errorf("unknown decision '%d'", decision)
+}
+
+// retry republishes the message straight to the configured queue (via the
+// default exchange) with an incremented retry counter.
+func (r *Rabbit) retry(ctx context.Context, msg amqp.Delivery) error {
+	if r.Options.QueueName == "" {
+		return errors.New("cannot retry messages on a server-named queue")
+	}
+
+	headers := amqp.Table{}
+
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	headers[RetryCountHeader] = RetryCount(msg) + 1
+
+	if _, ok := headers[RetryStartedHeader]; !ok {
+		headers[RetryStartedHeader] = time.Now().UnixMilli()
+	}
+
+	p := deliveryToPublishing(msg)
+	p.Headers = headers
+
+	r.ProducerRWMutex.RLock()
+	defer r.ProducerRWMutex.RUnlock()
+
+	if r.ProducerServerChannel == nil {
+		return errors.New("no server channel available")
+	}
+
+	return r.ProducerServerChannel.PublishWithContext(ctx, "", r.Options.QueueName, false, false, p)
+}
+
+// RetryCount returns the number of times the message has been retried via the
+// `Retry` decision.
+func RetryCount(msg amqp.Delivery) int64 {
+	switch v := msg.Headers[RetryCountHeader].(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	}
+
+	return 0
+}
+
+// deliveryToPublishing copies the properties and body of a delivery into a
+// new message, ready to be published again.
+func deliveryToPublishing(msg amqp.Delivery) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
@@ -0,0 +1,216 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// DefaultDedupTTL is how long `MemoryDedupStore` remembers the keys of
+	// processed messages, if no TTL is given.
+	DefaultDedupTTL = time.Hour
+
+	// DefaultDedupLease is how long `MemoryDedupStore` holds the keys of
+	// messages being processed, capped at its TTL; if the consumer dies
+	// mid-handler, redeliveries are processed again once it expires.
+	DefaultDedupLease = time.Minute
+
+	// DefaultDedupTimeout bounds each call `Deduplicate()` handlers make to
+	// their `DedupStore`.
+	DefaultDedupTimeout = 5 * time.Second
+)
+
+// ErrDuplicate is returned by `Deduplicate()` handlers for messages already
+// processed (or being processed); the library acks such messages whatever the
+// `AckPolicy` (as the handler was not run) and does not pass the error down
+// the error channel.
+var ErrDuplicate = errors.New("message already processed")
+
+// DedupStore keeps track of the messages processed by `Deduplicate()`
+// handlers; see `MemoryDedupStore` for an in-memory implementation and the
+// redis package for one that can be shared by multiple consumers.
+type DedupStore interface {
+	// Claim records the key for a short lease, reporting false if it was
+	// already recorded (ie. the message is a duplicate or is being processed)
+	Claim(ctx context.Context, key string) (bool, error)
+
+	// Commit keeps the claimed key for the store's full TTL, once the message
+	// has been processed
+	Commit(ctx context.Context, key string) error
+
+	// Release forgets the key, so that the message is processed again when
+	// redelivered (eg. because its handler failed)
+	Release(ctx context.Context, key string) error
+}
+
+// Deduplicate wraps the handler so that messages already processed (eg.
+// redelivered after a reconnect) are acked without running it again (see
+// `ErrDuplicate`); messages are keyed by the given header or, if empty, their
+// message ID. Messages without a key are always processed.
+//
+// Keys are claimed for a short lease before running the handler, so that
+// concurrent redeliveries are processed once, committed once it succeeds and
+// released if it fails. If the consumer dies mid-handler, redeliveries are
+// skipped until the lease expires and processed afterwards; handlers running
+// for longer than the lease may be run again for a redelivery. Errors
+// claiming keys are returned without running the handler; if committing fails,
+// the key is only remembered for the lease. Each call to the store is bounded
+// by `DefaultDedupTimeout`.
+//
+//	r.Consume(ctx, errChan, rabbit.Deduplicate(store, "", handler))
+func Deduplicate(store DedupStore, header string, f func(msg amqp.Delivery) error) func(msg amqp.Delivery) error {
+	return func(msg amqp.Delivery) error {
+		key := dedupKey(msg, header)
+		if key == "" {
+			return f(msg)
+		}
+
+		claimed, err := claimDedupKey(store, key)
+		if err != nil {
+			return fmt.Errorf("unable to check for duplicate message '%s': %w", key, err)
+		}
+
+		if !claimed {
+			return ErrDuplicate
+		}
+
+		err = f(msg)
+
+		// Only bound the store calls, not the handler
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultDedupTimeout)
+		defer cancel()
+
+		if err != nil {
+			if releaseErr := store.Release(ctx, key); releaseErr != nil {
+				return fmt.Errorf("%w (and unable to release message '%s': %s)", err, key, releaseErr)
+			}
+
+			return err
+		}
+
+		// Processed either way; the lease keeps duplicates out for a while
+		store.Commit(ctx, key)
+
+		return nil
+	}
+}
+
+func claimDedupKey(store DedupStore, key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDedupTimeout)
+	defer cancel()
+
+	return store.Claim(ctx, key)
+}
+
+func dedupKey(msg amqp.Delivery, header string) string {
+	if header == "" {
+		return msg.MessageId
+	}
+
+	v, ok := msg.Headers[header]
+	if !ok {
+		return ""
+	}
+
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+var _ DedupStore = (*MemoryDedupStore)(nil)
+
+// MemoryDedupStore is a `DedupStore` remembering keys in memory for a given
+// time; it is only suitable for a single consumer process.
+type MemoryDedupStore struct {
+	ttl       time.Duration
+	lease     time.Duration
+	keys      map[string]time.Time
+	lastSweep time.Time
+	mutex     *sync.Mutex
+}
+
+// NewMemoryDedupStore returns a `MemoryDedupStore` remembering keys for the
+// given time (`DefaultDedupTTL` if 0), holding them for `DefaultDedupLease`
+// while messages are processed.
+func NewMemoryDedupStore(ttl time.Duration) *MemoryDedupStore {
+	if ttl <= 0 {
+		ttl = DefaultDedupTTL
+	}
+
+	lease := DefaultDedupLease
+	if lease > ttl {
+		lease = ttl
+	}
+
+	return &MemoryDedupStore{
+		ttl:       ttl,
+		lease:     lease,
+		keys:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// Claim records the key for the lease, reporting false if it is already
+// recorded and has not expired.
+func (s *MemoryDedupStore) Claim(_ context.Context, key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+
+	// Keep memory bounded without a background goroutine
+	if now.Sub(s.lastSweep) >= s.ttl {
+		for k, expiry := range s.keys {
+			if now.After(expiry) {
+				delete(s.keys, k)
+			}
+		}
+
+		s.lastSweep = now
+	}
+
+	if expiry, ok := s.keys[key]; ok && !now.After(expiry) {
+		return false, nil
+	}
+
+	s.keys[key] = now.Add(s.lease)
+
+	return true, nil
+}
+
+// Commit remembers the key for the TTL.
+func (s *MemoryDedupStore) Commit(_ context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.keys[key] = time.Now().Add(s.ttl)
+
+	return nil
+}
+
+// Release forgets the key.
+func (s *MemoryDedupStore) Release(_ context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.keys, key)
+
+	return nil
+}
+
+// Len returns the number of keys currently remembered (including expired ones
+// not swept yet).
+func (s *MemoryDedupStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.keys)
+}
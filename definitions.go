@@ -0,0 +1,220 @@
+package rabbit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultVhost is the virtual host used when exporting definitions.
+const DefaultVhost = "/"
+
+// definitions mirrors the subset of RabbitMQ's definitions.json format (as
+// used by the management plugin) that describes a topology.
+type definitions struct {
+	Exchanges []exchangeDefinition `json:"exchanges"`
+	Queues    []queueDefinition    `json:"queues"`
+	Bindings  []bindingDefinition  `json:"bindings"`
+}
+
+type exchangeDefinition struct {
+	Name       string                 `json:"name"`
+	Vhost      string                 `json:"vhost"`
+	Type       string                 `json:"type"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Internal   bool                   `json:"internal"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+type queueDefinition struct {
+	Name       string                 `json:"name"`
+	Vhost      string                 `json:"vhost"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+type bindingDefinition struct {
+	Source          string                 `json:"source"`
+	Vhost           string                 `json:"vhost"`
+	Destination     string                 `json:"destination"`
+	DestinationType string                 `json:"destination_type"`
+	RoutingKey      string                 `json:"routing_key"`
+	Arguments       map[string]interface{} `json:"arguments"`
+}
+
+// ExportDefinitions serialises the topology in RabbitMQ's definitions.json
+// format, so that it can be imported via the management plugin; all objects
+// are assigned to the default virtual host.
+//
+// Exclusive queues are connection-scoped and cannot be expressed in the
+// definitions format, so they are skipped.
+func (t *Topology) ExportDefinitions() ([]byte, error) {
+	defs := definitions{
+		Exchanges: []exchangeDefinition{},
+		Queues:    []queueDefinition{},
+		Bindings:  []bindingDefinition{},
+	}
+
+	for _, e := range t.Exchanges {
+		defs.Exchanges = append(defs.Exchanges, exchangeDefinition{
+			Name:       e.Name,
+			Vhost:      DefaultVhost,
+			Type:       e.Type,
+			Durable:    e.Durable,
+			AutoDelete: e.AutoDelete,
+			Internal:   e.Internal,
+			Arguments:  toArguments(e.Args),
+		})
+	}
+
+	for _, q := range t.Queues {
+		if q.Exclusive {
+			continue
+		}
+
+		defs.Queues = append(defs.Queues, queueDefinition{
+			Name:       q.Name,
+			Vhost:      DefaultVhost,
+			Durable:    q.Durable,
+			AutoDelete: q.AutoDelete,
+			Arguments:  toArguments(q.Args),
+		})
+	}
+
+	for _, b := range t.Bindings {
+		destinationType := b.DestinationType
+		if destinationType == "" {
+			destinationType = DestinationQueue
+		}
+
+		defs.Bindings = append(defs.Bindings, bindingDefinition{
+			Source:          b.Source,
+			Vhost:           DefaultVhost,
+			Destination:     b.Destination,
+			DestinationType: destinationType,
+			RoutingKey:      b.RoutingKey,
+			Arguments:       toArguments(b.Args),
+		})
+	}
+
+	data, err := json.MarshalIndent(defs, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal definitions: %w", err)
+	}
+
+	return data, nil
+}
+
+// LoadDefinitions reads a topology from RabbitMQ's definitions.json format
+// (eg. as exported by the management plugin); anything other than exchanges,
+// queues and bindings (users, policies, etc.) is ignored.
+func LoadDefinitions(r io.Reader) (*Topology, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	defs := definitions{}
+
+	if err := decoder.Decode(&defs); err != nil {
+		return nil, fmt.Errorf("unable to decode definitions: %w", err)
+	}
+
+	t := &Topology{}
+
+	for _, e := range defs.Exchanges {
+		t.Exchanges = append(t.Exchanges, ExchangeSpec{
+			Name:       e.Name,
+			Type:       e.Type,
+			Durable:    e.Durable,
+			AutoDelete: e.AutoDelete,
+			Internal:   e.Internal,
+			Args:       fromArguments(e.Arguments),
+		})
+	}
+
+	for _, q := range defs.Queues {
+		t.Queues = append(t.Queues, QueueSpec{
+			Name:       q.Name,
+			Durable:    q.Durable,
+			AutoDelete: q.AutoDelete,
+			Args:       fromArguments(q.Arguments),
+		})
+	}
+
+	for _, b := range defs.Bindings {
+		t.Bindings = append(t.Bindings, BindingSpec{
+			Source:          b.Source,
+			Destination:     b.Destination,
+			DestinationType: b.DestinationType,
+			RoutingKey:      b.RoutingKey,
+			Args:            fromArguments(b.Arguments),
+		})
+	}
+
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid definitions: %w", err)
+	}
+
+	return t, nil
+}
+
+// LoadDefinitionsFromBytes is a convenience wrapper around `LoadDefinitions()`.
+func LoadDefinitionsFromBytes(data []byte) (*Topology, error) {
+	return LoadDefinitions(bytes.NewReader(data))
+}
+
+func toArguments(args amqp.Table) map[string]interface{} {
+	arguments := map[string]interface{}{}
+
+	for k, v := range args {
+		arguments[k] = v
+	}
+
+	return arguments
+}
+
+// fromArguments converts JSON arguments into an amqp.Table, turning numbers
+// into integers wherever possible since that is what the server expects for
+// arguments like x-max-priority or x-message-ttl.
+func fromArguments(arguments map[string]interface{}) amqp.Table {
+	if len(arguments) == 0 {
+		return nil
+	}
+
+	args := amqp.Table{}
+
+	for k, v := range arguments {
+		args[k] = fromJSONValue(v)
+	}
+
+	return args
+}
+
+func fromJSONValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := value.Float64()
+
+		return f
+	case map[string]interface{}:
+		return fromArguments(value)
+	case []interface{}:
+		values := make([]interface{}, len(value))
+
+		for i := range value {
+			values[i] = fromJSONValue(value[i])
+		}
+
+		return values
+	}
+
+	return v
+}
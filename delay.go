@@ -0,0 +1,127 @@
+package rabbit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// DelayQueuePrefix prefixes the names of the wait queues (and of the
+	// exchanges routing to them) declared by `PublishAfter()`.
+	DelayQueuePrefix = "rabbit.delay."
+
+	// ExchangeDelayedMessage is the type of the exchanges provided by the
+	// delayed-message plugin (rabbitmq_delayed_message_exchange), which hold
+	// messages for the delay set via `WithDelay()` before routing them; such
+	// exchanges must be declared with `DelayedTypeArg` in their arguments.
+	ExchangeDelayedMessage = "x-delayed-message"
+
+	// DelayedTypeArg is the argument setting the type of exchange (eg.
+	// "topic") an `ExchangeDelayedMessage` exchange routes messages as.
+	DelayedTypeArg = "x-delayed-type"
+
+	// DelayHeader is the header read by `ExchangeDelayedMessage` exchanges,
+	// carrying the delay in milliseconds.
+	DelayHeader = "x-delay"
+
+	// delayQueueExpiry is how long a wait queue outlives its last use before
+	// the server deletes it.
+	delayQueueExpiry = time.Minute
+)
+
+// PublishAfter is the same as `Publish()` but the message is delivered to the
+// configured exchange only once the given delay has elapsed, without the need
+// for broker plugins.
+//
+// The message is parked in a wait queue (one per exchange and delay, declared
+// by the library and named after `DelayQueuePrefix`) with a per-message TTL
+// set to the delay; once expired, the server dead-letters it to the exchange,
+// with its routing key preserved. Any expiration set via `WithExpiration()` is
+// overridden, and the delay is rounded down to the millisecond. Wait queues
+// are deleted by the server once unused for a while.
+//
+// A delay that is not positive publishes the message straight away.
+func (r *Rabbit) PublishAfter(ctx context.Context, delay time.Duration, routingKey string, body []byte, opts ...PublishOption) error {
+	exchange := r.exchange
+
+	if delay.Milliseconds() <= 0 {
+		return r.PublishTo(ctx, exchange, routingKey, body, opts...)
+	}
+
+	if r.Options.Mode == Consumer {
+		return fmt.Errorf("unable to Publish - library is configured in Consumer mode: %w", ErrWrongMode)
+	}
+
+	name, err := r.declareDelayQueue(ctx, exchange, delay)
+	if err != nil {
+		return err
+	}
+
+	return r.PublishTo(ctx, name, routingKey, body, append(opts, WithExpiration(delay))...)
+}
+
+// WithDelay sets the delay (see `DelayHeader`) after which an
+// `ExchangeDelayedMessage` exchange routes the message; it requires the
+// delayed-message plugin, and is ignored by any other type of exchange (see
+// `PublishAfter()` for an alternative).
+func WithDelay(delay time.Duration) PublishOption {
+	return func(p *amqp.Publishing) {
+		setHeader(p, DelayHeader, delay.Milliseconds())
+	}
+}
+
+// validateDelayedType records a problem in `v` if an `ExchangeDelayedMessage`
+// exchange is declared without `DelayedTypeArg`.
+func validateDelayedType(v *ValidationError, field, exchangeType string, args amqp.Table) {
+	if exchangeType != ExchangeDelayedMessage {
+		return
+	}
+
+	if delayedType, ok := args[DelayedTypeArg].(string); !ok || delayedType == "" {
+		v.add(field, "must set '%s' for %s exchanges", DelayedTypeArg, ExchangeDelayedMessage)
+	}
+}
+
+// declareDelayQueue declares the wait queue for the given exchange and delay,
+// along with the exchange routing all messages to it, unless they have been
+// declared recently; the name of both is returned.
+func (r *Rabbit) declareDelayQueue(ctx context.Context, exchange string, delay time.Duration) (string, error) {
+	name := fmt.Sprintf("%s%s.%d", DelayQueuePrefix, exchange, delay.Milliseconds())
+
+	// Declaring the queue again postpones its expiry, which must not happen
+	// before the messages published in the meantime are dead-lettered
+	r.delayQueuesMutex.Lock()
+	declaredAt, ok := r.delayQueues[name]
+	r.delayQueuesMutex.Unlock()
+
+	if ok && time.Since(declaredAt) < delayQueueExpiry/2 {
+		return name, nil
+	}
+
+	if err := r.withChannel(ctx, func(ch *amqp.Channel) error {
+		if _, err := ch.QueueDeclare(name, true, false, false, false, amqp.Table{
+			"x-dead-letter-exchange": exchange,
+			"x-expires":              (delay + delayQueueExpiry).Milliseconds(),
+		}); err != nil {
+			return err
+		}
+
+		// Deleted along with its binding, once the queue expires
+		if err := ch.ExchangeDeclare(name, amqp.ExchangeFanout, true, true, false, false, nil); err != nil {
+			return err
+		}
+
+		return ch.QueueBind(name, "", name, false, nil)
+	}); err != nil {
+		return "", fmt.Errorf("unable to declare delay queue '%s': %w", name, err)
+	}
+
+	r.delayQueuesMutex.Lock()
+	r.delayQueues[name] = time.Now()
+	r.delayQueuesMutex.Unlock()
+
+	return name, nil
+}
@@ -0,0 +1,179 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPort is the port of the server if unset in an amqp:// URL
+	DefaultPort = 5672
+
+	// DefaultTLSPort is the port of the server if unset in an amqps:// URL
+	DefaultTLSPort = 5671
+)
+
+// Overridden in tests
+var (
+	lookupHost = net.DefaultResolver.LookupHost
+	lookupSRV  = net.DefaultResolver.LookupSRV
+)
+
+// Discoverer discovers the servers to connect to (eg. via a service registry);
+// it is queried on every (re)connect, so that changes in cluster membership
+// are picked up. See `Options.Discoverer`.
+type Discoverer interface {
+	// Discover returns the addresses ("host:port") of the servers
+	Discover(ctx context.Context) ([]string, error)
+}
+
+// target is a server to connect to; if set, `addr` is dialed instead of the
+// host of `url` (which is still used for TLS verification).
+type target struct {
+	url  string
+	addr string
+}
+
+func (t target) key() string {
+	return t.url + "@" + t.addr
+}
+
+// resolve turns URLs into the servers to connect to: if `Options.Discoverer`
+// is set, each URL is combined with every discovered address; otherwise, URLs
+// using the amqp+srv (or amqps+srv) scheme are expanded via a DNS SRV lookup
+// of their host and, if `Options.ResolveURLs` is set, host names are resolved
+// via DNS into one server per address.
+func resolve(ctx context.Context, opts *Options, urls []string) ([]target, error) {
+	if opts.Discoverer != nil {
+		return discover(ctx, opts, urls)
+	}
+
+	var targets []target
+	var lastErr error
+
+	for _, raw := range urls {
+		resolved, err := resolveURL(ctx, opts, raw)
+		if err != nil {
+			opts.Log.Warnf("unable to resolve server URL: %s", err)
+			lastErr = err
+			continue
+		}
+
+		targets = append(targets, resolved...)
+	}
+
+	if len(targets) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	return targets, nil
+}
+
+func resolveURL(ctx context.Context, opts *Options, raw string) ([]target, error) {
+	if !isSRVURL(raw) && !opts.ResolveURLs {
+		return []target{{url: raw}}, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.New("invalid URL")
+	}
+
+	var urls []string
+
+	if isSRVURL(raw) {
+		_, srvs, err := lookupSRV(ctx, "", "", u.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf("unable to look up SRV records of '%s': %w", u.Hostname(), err)
+		}
+
+		// Records are sorted by priority (and randomized by weight)
+		for _, srv := range srvs {
+			resolved := *u
+			resolved.Scheme = strings.TrimSuffix(strings.ToLower(u.Scheme), "+srv")
+			resolved.Host = net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+
+			urls = append(urls, resolved.String())
+		}
+	} else {
+		urls = append(urls, raw)
+	}
+
+	if !opts.ResolveURLs {
+		targets := make([]target, 0, len(urls))
+
+		for _, resolved := range urls {
+			targets = append(targets, target{url: resolved})
+		}
+
+		return targets, nil
+	}
+
+	var targets []target
+
+	for _, resolved := range urls {
+		u, err := url.Parse(resolved)
+		if err != nil {
+			return nil, errors.New("invalid URL")
+		}
+
+		port := u.Port()
+		if port == "" {
+			port = strconv.Itoa(DefaultPort)
+
+			if isTLSURL(resolved) {
+				port = strconv.Itoa(DefaultTLSPort)
+			}
+		}
+
+		// IP addresses need no resolution
+		if net.ParseIP(u.Hostname()) != nil {
+			targets = append(targets, target{url: resolved})
+			continue
+		}
+
+		addrs, err := lookupHost(ctx, u.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf("unable to look up '%s': %w", u.Hostname(), err)
+		}
+
+		for _, addr := range addrs {
+			targets = append(targets, target{
+				url:  resolved,
+				addr: net.JoinHostPort(addr, port),
+			})
+		}
+	}
+
+	return targets, nil
+}
+
+func discover(ctx context.Context, opts *Options, urls []string) ([]target, error) {
+	addrs, err := opts.Discoverer.Discover(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover servers: %w", err)
+	}
+
+	targets := make([]target, 0, len(urls)*len(addrs))
+
+	for _, url := range urls {
+		for _, addr := range addrs {
+			targets = append(targets, target{
+				url:  url,
+				addr: addr,
+			})
+		}
+	}
+
+	return targets, nil
+}
+
+func isSRVURL(url string) bool {
+	url = strings.ToLower(url)
+	return strings.HasPrefix(url, "amqp+srv://") || strings.HasPrefix(url, "amqps+srv://")
+}
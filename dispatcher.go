@@ -0,0 +1,97 @@
+package rabbit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultMessageTypeHeader is the header used by `Dispatcher` to determine
+// the type of a message, unless configured otherwise.
+const DefaultMessageTypeHeader = "x-message-type"
+
+// ErrUnknownMessageType is returned by `Dispatcher.Dispatch()` when there is
+// no handler registered for the message type and no fallback handler is set.
+var ErrUnknownMessageType = errors.New("unknown message type")
+
+// Dispatcher routes deliveries to handlers based on the message type, read
+// from a configurable header; it is meant to be used as the handler passed to
+// `Consume()` for queues carrying heterogeneous messages:
+//
+//	d := rabbit.NewDispatcher("")
+//	d.Handle("user.created", onUserCreated)
+//	d.Handle("user.deleted", onUserDeleted)
+//	d.Fallback(onUnknown)
+//
+//	r.Consume(ctx, errChan, d.Dispatch)
+type Dispatcher struct {
+	header   string
+	handlers map[string]func(msg amqp.Delivery) error
+	fallback func(msg amqp.Delivery) error
+	mutex    *sync.RWMutex
+}
+
+// NewDispatcher creates a new dispatcher reading the message type from the
+// given header (`DefaultMessageTypeHeader` if empty); if the header is not
+// present on a delivery, its `Type` property is used instead.
+func NewDispatcher(header string) *Dispatcher {
+	if header == "" {
+		header = DefaultMessageTypeHeader
+	}
+
+	return &Dispatcher{
+		header:   header,
+		handlers: make(map[string]func(msg amqp.Delivery) error),
+		mutex:    &sync.RWMutex{},
+	}
+}
+
+// Handle registers the handler for the given message type, replacing any
+// previously registered one.
+func (d *Dispatcher) Handle(messageType string, f func(msg amqp.Delivery) error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.handlers[messageType] = f
+}
+
+// Fallback sets the handler for messages of unknown type.
+func (d *Dispatcher) Fallback(f func(msg amqp.Delivery) error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.fallback = f
+}
+
+// Dispatch runs the handler registered for the message type of the delivery,
+// or the fallback handler if there is none.
+func (d *Dispatcher) Dispatch(msg amqp.Delivery) error {
+	messageType := d.messageType(msg)
+
+	d.mutex.RLock()
+	f, ok := d.handlers[messageType]
+	if !ok {
+		f = d.fallback
+	}
+	d.mutex.RUnlock()
+
+	if f == nil {
+		return fmt.Errorf("no handler for message type '%s': %w", messageType, ErrUnknownMessageType)
+	}
+
+	return f(msg)
+}
+
+func (d *Dispatcher) messageType(msg amqp.Delivery) string {
+	if v, ok := msg.Headers[d.header]; ok {
+		if s, ok := v.(string); ok {
+			return s
+		}
+
+		return fmt.Sprintf("%v", v)
+	}
+
+	return msg.Type
+}
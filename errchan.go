@@ -0,0 +1,199 @@
+package rabbit
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// errorQueue is a ring buffer of the errors pending for an error channel;
+// at most one goroutine at a time drains it, so errors are received in the
+// order they were reported.
+type errorQueue struct {
+	errChan  chan *ConsumeError
+	errors   []*ConsumeError
+	head     int
+	size     int
+	draining bool
+}
+
+// ErrorWriter passes consume errors down error channels as per
+// `Options.OnError`, `Options.ErrorPolicy` and `Options.ErrorBufferSize`; it
+// is shared by the backends, so that errors are reported the same way
+// whichever is in use. It is instantiated via `NewErrorWriter()`.
+type ErrorWriter struct {
+	opts    *Options
+	done    <-chan struct{}
+	queues  map[chan *ConsumeError]*errorQueue
+	dropped int64
+	mutex   *sync.Mutex
+}
+
+// NewErrorWriter returns an `ErrorWriter` for the given options, which are
+// read on every write; pending errors are dropped once `done` is closed.
+func NewErrorWriter(opts *Options, done <-chan struct{}) *ErrorWriter {
+	return &ErrorWriter{
+		opts:   opts,
+		done:   done,
+		queues: make(map[chan *ConsumeError]*errorQueue),
+		mutex:  &sync.Mutex{},
+	}
+}
+
+// Dropped returns how many errors have not been passed down the error
+// channel, as per `Options.ErrorPolicy` (or because `done` was closed while
+// the error was pending).
+func (w *ErrorWriter) Dropped() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// DroppedErrors returns how many errors have not been passed down the error
+// channel, as per `Options.ErrorPolicy` (or because the library was stopped
+// while the error was pending).
+func (r *Rabbit) DroppedErrors() int64 {
+	return r.errWriter.Dropped()
+}
+
+// writeError hands the error to `Options.OnError` (if set) and passes it down
+// the error channel (if any), as per `Options.ErrorPolicy`.
+func (r *Rabbit) writeError(errChan chan *ConsumeError, consumeErr *ConsumeError) {
+	r.errWriter.Write(errChan, consumeErr)
+}
+
+// Write hands the error to `Options.OnError` (if set) and passes it down the
+// error channel (if any), as per `Options.ErrorPolicy`.
+func (w *ErrorWriter) Write(errChan chan *ConsumeError, consumeErr *ConsumeError) {
+	if w.opts.OnError != nil {
+		w.opts.OnError(consumeErr)
+	}
+
+	if errChan == nil {
+		return
+	}
+
+	switch w.opts.ErrorPolicy {
+	case ErrorsBlock:
+		select {
+		case errChan <- consumeErr:
+		case <-w.done:
+			w.dropError()
+		}
+	case ErrorsDropNewest:
+		select {
+		case errChan <- consumeErr:
+		default:
+			w.dropError()
+		}
+	case ErrorsDropOldest:
+		for {
+			select {
+			case errChan <- consumeErr:
+				return
+			default:
+			}
+
+			// Make room, unless someone else just did
+			select {
+			case <-errChan:
+				w.dropError()
+			default:
+				// Unbuffered channel with nobody receiving
+				if cap(errChan) == 0 {
+					w.dropError()
+					return
+				}
+			}
+		}
+	case ErrorsBuffer:
+		w.queueError(errChan, consumeErr, false)
+	default:
+		w.queueError(errChan, consumeErr, true)
+	}
+}
+
+// queueError appends the error to the queue of `errChan`, dropping either
+// the oldest pending error (if `dropOldest` is set) or the new one if the
+// queue is full, and makes sure the queue is being drained.
+func (w *ErrorWriter) queueError(errChan chan *ConsumeError, consumeErr *ConsumeError, dropOldest bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	q, ok := w.queues[errChan]
+	if !ok {
+		size := w.opts.ErrorBufferSize
+		if size <= 0 {
+			size = DefaultErrorBufferSize
+		}
+
+		q = &errorQueue{
+			errChan: errChan,
+			errors:  make([]*ConsumeError, size),
+		}
+
+		w.queues[errChan] = q
+	}
+
+	if q.size == len(q.errors) {
+		w.dropError()
+
+		if !dropOldest {
+			return
+		}
+
+		q.errors[q.head] = nil
+		q.head = (q.head + 1) % len(q.errors)
+		q.size--
+	}
+
+	q.errors[(q.head+q.size)%len(q.errors)] = consumeErr
+	q.size++
+
+	if !q.draining {
+		q.draining = true
+		go w.drainErrors(q)
+	}
+}
+
+// drainErrors writes the queued errors to the error channel until the queue
+// is empty or `done` is closed (in which case the pending errors are
+// dropped).
+func (w *ErrorWriter) drainErrors(q *errorQueue) {
+	for {
+		w.mutex.Lock()
+
+		if q.size == 0 {
+			q.draining = false
+			// Do not keep track of channels that may be no longer in use
+			delete(w.queues, q.errChan)
+			w.mutex.Unlock()
+
+			return
+		}
+
+		consumeErr := q.errors[q.head]
+		q.errors[q.head] = nil
+		q.head = (q.head + 1) % len(q.errors)
+		q.size--
+
+		w.mutex.Unlock()
+
+		select {
+		case q.errChan <- consumeErr:
+		case <-w.done:
+			w.mutex.Lock()
+
+			atomic.AddInt64(&w.dropped, int64(q.size)+1)
+
+			q.size = 0
+			q.draining = false
+			delete(w.queues, q.errChan)
+
+			w.mutex.Unlock()
+
+			return
+		}
+	}
+}
+
+func (w *ErrorWriter) dropError() {
+	atomic.AddInt64(&w.dropped, 1)
+}
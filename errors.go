@@ -0,0 +1,90 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// The errors returned by the library wrap one of the following (where
+// applicable), so that they can be told apart by means of `errors.Is()`.
+var (
+	// ErrShutdown will be returned if the underlying connection has already
+	// been closed (ie. if you Close()'d and then tried to Publish())
+	ErrShutdown = errors.New("connection has been shutdown")
+
+	// ErrNotConnected is returned when the connection to the server (or the
+	// channel in use) is not available, eg. while reconnecting
+	ErrNotConnected = errors.New("not connected to the server")
+
+	// ErrPublishTimeout is returned when a publish does not complete before
+	// the deadline of the passed in context
+	ErrPublishTimeout = errors.New("publish timed out")
+
+	// ErrUnroutable is returned when a message published as mandatory is
+	// returned by the server because it could not be routed to any queue
+	ErrUnroutable = errors.New("message could not be routed to any queue")
+
+	// ErrWrongMode is returned when calling a method that is not supported in
+	// the configured `Options.Mode` (eg. `Publish()` in Consumer mode)
+	ErrWrongMode = errors.New("operation not supported in the configured mode")
+
+	// ErrConsumerCancelled is passed down the error channel (in a `ConsumeError`
+	// with a nil `Message`) when the server cancels the consumer (eg. if the
+	// queue is deleted); the consumer is re-subscribed automatically
+	ErrConsumerCancelled = errors.New("consumer has been cancelled by the server")
+
+	// ErrCircuitOpen is returned when publishing while the publish circuit
+	// breaker is open (see `Options.PublishBreaker`), rather than waiting on
+	// an unhealthy server
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// sentinelError ties an error to one of the sentinel errors above, so that
+// `errors.Is()` matches both the sentinel and anything in the error's chain
+// (eg. `context.DeadlineExceeded`).
+type sentinelError struct {
+	sentinel error
+	cause    error
+}
+
+func (e *sentinelError) Error() string {
+	return e.sentinel.Error() + ": " + e.cause.Error()
+}
+
+func (e *sentinelError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *sentinelError) Unwrap() error {
+	return e.cause
+}
+
+func withSentinel(sentinel, cause error) error {
+	if errors.Is(cause, sentinel) {
+		return cause
+	}
+
+	return &sentinelError{sentinel: sentinel, cause: cause}
+}
+
+// connectionError ties errors caused by a closed connection or channel to
+// `ErrNotConnected`.
+func connectionError(err error) error {
+	if errors.Is(err, amqp.ErrClosed) {
+		return withSentinel(ErrNotConnected, err)
+	}
+
+	return err
+}
+
+// publishError ties errors returned while publishing to `ErrNotConnected` or
+// `ErrPublishTimeout`.
+func publishError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return withSentinel(ErrPublishTimeout, err)
+	}
+
+	return connectionError(err)
+}
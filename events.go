@@ -0,0 +1,106 @@
+package rabbit
+
+import "time"
+
+const (
+	// EventConnected is emitted once the library has connected to the server
+	// on instantiation.
+	EventConnected EventType = 0
+	// EventDisconnected is emitted when the connection is lost; `Event.Err`
+	// is the reason given by the server, if any.
+	EventDisconnected EventType = 1
+	// EventReconnectAttempt is emitted before every reconnect attempt, with
+	// `Event.Attempt` set, and with `Event.Err` set to the error the previous
+	// attempt failed with (if any).
+	EventReconnectAttempt EventType = 2
+	// EventReconnected is emitted once the connection has been re-established.
+	EventReconnected EventType = 3
+	// EventBlocked is emitted when the server blocks the connection, with
+	// `Event.Reason` set (see `Options.OnBlocked`).
+	EventBlocked EventType = 4
+	// EventUnblocked is emitted when the server unblocks the connection.
+	EventUnblocked EventType = 5
+	// EventConsumerCancelled is emitted when the server cancels a consumer,
+	// with `Event.ConsumerTag` set (see `ErrConsumerCancelled`).
+	EventConsumerCancelled EventType = 6
+	// EventBreakerStateChanged is emitted when a circuit breaker changes
+	// state, with `Event.Breaker` and `Event.BreakerState` set, and with
+	// `Event.Err` set to the error that opened it (if any).
+	EventBreakerStateChanged EventType = 7
+
+	// EventBufferSize is the capacity of the channel returned by `Events()`.
+	EventBufferSize = 100
+)
+
+// EventType is the type used to represent the kind of a connection lifecycle
+// event.
+type EventType int
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "Connected"
+	case EventDisconnected:
+		return "Disconnected"
+	case EventReconnectAttempt:
+		return "ReconnectAttempt"
+	case EventReconnected:
+		return "Reconnected"
+	case EventBlocked:
+		return "Blocked"
+	case EventUnblocked:
+		return "Unblocked"
+	case EventConsumerCancelled:
+		return "ConsumerCancelled"
+	case EventBreakerStateChanged:
+		return "BreakerStateChanged"
+	}
+
+	return "Unknown"
+}
+
+// Event is a connection lifecycle (or circuit breaker) event (see `Events()`); which fields are
+// set depends on its type.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Why the connection was lost or the previous reconnect attempt failed
+	Err error
+
+	// Reconnect attempt number (starting from 1)
+	Attempt int
+
+	// Why the connection was blocked
+	Reason string
+
+	// Tag of the cancelled consumer
+	ConsumerTag string
+
+	// Which circuit breaker changed state (eg. "consumer")
+	Breaker string
+
+	// State the circuit breaker changed to
+	BreakerState BreakerState
+}
+
+// Events returns a channel on which connection lifecycle events are emitted,
+// so that they can be reacted to without polling; it is the same channel on
+// every call and it is never closed. Events are dropped if the channel is
+// full (see `EventBufferSize`), so that a slow (or missing) reader does not
+// hold up the library.
+func (r *Rabbit) Events() <-chan Event {
+	return r.events
+}
+
+// emit sends the event on the events channel, unless it is full.
+func (r *Rabbit) emit(event Event) {
+	event.Time = time.Now()
+
+	select {
+	case r.events <- event:
+	default:
+		r.log.Debugf("dropping %s event: events channel is full", event.Type)
+	}
+}
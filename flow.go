@@ -0,0 +1,177 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	// ErrConnectionBlocked is returned when publishing while the server has
+	// blocked the connection and `Options.PublishFailFastWhenBlocked` is set.
+	ErrConnectionBlocked = errors.New("connection has been blocked by the server")
+
+	// ErrFlowBlocked is returned when publishing while the server has paused
+	// the flow of the channel and `Options.PublishFailFastWhenBlocked` is set.
+	ErrFlowBlocked = errors.New("channel flow has been paused by the server")
+)
+
+// Blocked returns whether the server is currently blocking the connection
+// (eg. because of a memory or disk alarm); see `Options.OnBlocked`.
+func (r *Rabbit) Blocked() bool {
+	r.blockedMutex.Lock()
+	defer r.blockedMutex.Unlock()
+
+	return r.unblocked != nil
+}
+
+// FlowPaused returns whether the server has currently paused the flow of the
+// channel used for publishing (see channel.flow in the AMQP spec).
+func (r *Rabbit) FlowPaused() bool {
+	r.blockedMutex.Lock()
+	defer r.blockedMutex.Unlock()
+
+	return r.flowResumed != nil
+}
+
+// BlockedDuration returns the total time during which publishing has been
+// held back by the server, either by blocking the connection or by pausing
+// the flow of the channel.
+func (r *Rabbit) BlockedDuration() time.Duration {
+	r.blockedMutex.Lock()
+	defer r.blockedMutex.Unlock()
+
+	total := r.blockedTotal
+
+	if r.paused() {
+		total += time.Since(r.blockedSince)
+	}
+
+	return total
+}
+
+// watchNotifyBlocked keeps track of the connection.blocked/unblocked
+// notifications sent by the server.
+func (r *Rabbit) watchNotifyBlocked(notifications <-chan amqp.Blocking) {
+	// The channel is closed (ending the loop) when the connection is closed
+	for b := range notifications {
+		if b.Active {
+			r.log.Warnf("connection blocked by server: %s", b.Reason)
+		} else {
+			r.log.Warn("connection unblocked by server")
+		}
+
+		r.setBlocked(b.Active)
+
+		if b.Active {
+			r.emit(Event{Type: EventBlocked, Reason: b.Reason})
+		} else {
+			r.emit(Event{Type: EventUnblocked})
+		}
+
+		if r.Options.OnBlocked != nil {
+			r.Options.OnBlocked(b)
+		}
+	}
+}
+
+// watchNotifyFlow keeps track of the channel.flow notifications sent by the
+// server for the given channel (used for publishing, or retired since).
+func (r *Rabbit) watchNotifyFlow(ch *amqp.Channel, notifications <-chan bool) {
+	// The channel is closed (ending the loop) when the amqp channel is closed
+	for active := range notifications {
+		if active {
+			r.log.Warn("channel flow resumed by server")
+		} else {
+			r.log.Warn("channel flow paused by server")
+		}
+
+		r.setFlow(ch, active)
+	}
+
+	// Only this channel's pause is over; a new channel starts with an active
+	// flow
+	r.setFlow(ch, true)
+}
+
+func (r *Rabbit) setBlocked(blocked bool) {
+	r.blockedMutex.Lock()
+	defer r.blockedMutex.Unlock()
+
+	r.updatePause(&r.unblocked, blocked)
+}
+
+// setFlow records the flow of the given channel; publishing is held back
+// while the flow of any channel is paused.
+func (r *Rabbit) setFlow(ch *amqp.Channel, active bool) {
+	r.blockedMutex.Lock()
+	defer r.blockedMutex.Unlock()
+
+	if active {
+		delete(r.flowPaused, ch)
+	} else {
+		r.flowPaused[ch] = struct{}{}
+	}
+
+	r.updatePause(&r.flowResumed, len(r.flowPaused) > 0)
+}
+
+// updatePause creates (on pause) or closes (on resume) the given channel,
+// keeping track of the time spent paused; callers must hold `blockedMutex`.
+func (r *Rabbit) updatePause(resumed *chan struct{}, pause bool) {
+	wasPaused := r.paused()
+
+	switch {
+	case pause && *resumed == nil:
+		*resumed = make(chan struct{})
+	case !pause && *resumed != nil:
+		close(*resumed)
+		*resumed = nil
+	}
+
+	switch isPaused := r.paused(); {
+	case isPaused && !wasPaused:
+		r.blockedSince = time.Now()
+	case !isPaused && wasPaused:
+		r.blockedTotal += time.Since(r.blockedSince)
+	}
+}
+
+func (r *Rabbit) paused() bool {
+	return r.unblocked != nil || r.flowResumed != nil
+}
+
+// waitUnblocked returns immediately if publishing is not held back by the
+// server; otherwise it either fails (if `Options.PublishFailFastWhenBlocked`
+// is set) or waits until publishing is resumed or `ctx` is done.
+func (r *Rabbit) waitUnblocked(ctx context.Context) error {
+	for {
+		r.blockedMutex.Lock()
+		unblocked, flowResumed := r.unblocked, r.flowResumed
+		r.blockedMutex.Unlock()
+
+		var resumed chan struct{}
+		var reason error
+
+		switch {
+		case unblocked != nil:
+			resumed, reason = unblocked, ErrConnectionBlocked
+		case flowResumed != nil:
+			resumed, reason = flowResumed, ErrFlowBlocked
+		default:
+			return nil
+		}
+
+		if r.Options.PublishFailFastWhenBlocked {
+			return reason
+		}
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return withSentinel(reason, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package rabbit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// ExchangeConsistentHash is the type of the exchanges provided by the
+	// consistent-hash plugin (rabbitmq_consistent_hash_exchange), which
+	// spread messages across the bound queues by hashing a key, so that all
+	// the messages with the same key end up in the same queue.
+	ExchangeConsistentHash = "x-consistent-hash"
+
+	// HashHeaderArg is the argument making an `ExchangeConsistentHash`
+	// exchange hash the value of the given header instead of the routing key.
+	HashHeaderArg = "hash-header"
+)
+
+// ConsistentHash describes an `ExchangeConsistentHash` exchange along with
+// the queues (partitions) it spreads messages across, enabling partitioned
+// processing: run one consumer per partition, and messages with the same hash
+// key are processed in order by the same consumer. It is declared via the
+// topology returned by `Topology()`, and published to via `PublishHashed()`.
+type ConsistentHash struct {
+	// Required
+	Exchange string `json:"exchange,omitempty" yaml:"exchange,omitempty"`
+
+	// Optional; header carrying the hash key, which is the routing key if unset
+	HashHeader string `json:"hash_header,omitempty" yaml:"hash_header,omitempty"`
+
+	// Required; the queues messages are spread across
+	Partitions []HashPartition `json:"partitions,omitempty" yaml:"partitions,omitempty"`
+
+	// Whether the exchange and the queues should survive/persist server
+	// restarts
+	Durable bool `json:"durable,omitempty" yaml:"durable,omitempty"`
+}
+
+// HashPartition is a queue bound to a `ConsistentHash` exchange.
+type HashPartition struct {
+	// Required
+	Queue string `json:"queue,omitempty" yaml:"queue,omitempty"`
+
+	// Share of the hash space assigned to the queue, relative to the other
+	// partitions; 1 if unset
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// Validate checks that the consistent-hash exchange is well formed; all the
+// problems found are reported at once by means of a `*ValidationError`.
+func (c *ConsistentHash) Validate() error {
+	v := &ValidationError{}
+
+	c.validate(v, "")
+
+	return v.errOrNil()
+}
+
+func (c *ConsistentHash) validate(v *ValidationError, prefix string) {
+	if c.Exchange == "" {
+		v.add(prefix+"Exchange", "cannot be empty")
+	}
+
+	if len(c.Partitions) == 0 {
+		v.add(prefix+"Partitions", "must contain at least one partition")
+	}
+
+	for i, p := range c.Partitions {
+		if p.Queue == "" {
+			v.add(fmt.Sprintf("%sPartitions[%d].Queue", prefix, i), "cannot be empty")
+		}
+
+		if p.Weight < 0 {
+			v.add(fmt.Sprintf("%sPartitions[%d].Weight", prefix, i), "cannot be negative")
+		}
+	}
+}
+
+// Topology returns the topology declaring the exchange and its partitions,
+// which can be applied via `Topology.Apply()` (or set as `Options.Topology`)
+// so that it is re-declared on reconnect; the weight of a partition is its
+// binding key, as expected by the plugin.
+func (c *ConsistentHash) Topology() *Topology {
+	t := &Topology{}
+
+	var args amqp.Table
+
+	if c.HashHeader != "" {
+		args = amqp.Table{HashHeaderArg: c.HashHeader}
+	}
+
+	t.Exchanges = append(t.Exchanges, ExchangeSpec{
+		Name:    c.Exchange,
+		Type:    ExchangeConsistentHash,
+		Durable: c.Durable,
+		Args:    args,
+	})
+
+	for _, p := range c.Partitions {
+		weight := p.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		t.Queues = append(t.Queues, QueueSpec{
+			Name:    p.Queue,
+			Durable: c.Durable,
+		})
+
+		t.Bindings = append(t.Bindings, BindingSpec{
+			Source:      c.Exchange,
+			Destination: p.Queue,
+			RoutingKey:  strconv.Itoa(weight),
+		})
+	}
+
+	return t
+}
+
+// PublishHashed publishes the message to the consistent-hash exchange, setting
+// the hash key as it expects: as the routing key or, if `HashHeader` is set,
+// as that header (with an empty routing key).
+func (r *Rabbit) PublishHashed(ctx context.Context, c *ConsistentHash, key string, body []byte, opts ...PublishOption) error {
+	if c.HashHeader == "" {
+		return r.PublishTo(ctx, c.Exchange, key, body, opts...)
+	}
+
+	header := c.HashHeader
+
+	return r.PublishTo(ctx, c.Exchange, "", body, append(opts, func(p *amqp.Publishing) {
+		setHeader(p, header, key)
+	})...)
+}
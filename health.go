@@ -0,0 +1,132 @@
+package rabbit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Ping verifies that the connection to the server is usable by opening (and
+// closing) a throwaway channel, for use in service health checks. Should ctx
+// expire first (eg. while the library is reconnecting), the returned error
+// wraps `ErrNotConnected` as well as the context error.
+func (r *Rabbit) Ping(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// withChannel() waits for reconnects to complete, regardless of ctx
+	done := make(chan error, 1)
+
+	go func() {
+		done <- r.withChannel(ctx, func(ch *amqp.Channel) error {
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("ping failed: %w", err)
+		}
+
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("ping failed: %w", withSentinel(ErrNotConnected, ctx.Err()))
+	}
+}
+
+// Healthz returns an HTTP handler reporting the health of the connection, for
+// use as (or in) a liveness/readiness endpoint: it responds with 200 while
+// connected, and with 503 (and the reason, eg. the last reconnect error) after
+// `Close()`, while reconnecting or if the connection has been closed. The body
+// is a JSON object such as `{"status":"ok"}`.
+func (r *Rabbit) Healthz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		status := healthStatus{Status: "ok"}
+		code := http.StatusOK
+
+		if err := r.health(); err != nil {
+			status = healthStatus{Status: "unavailable", Error: err.Error()}
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			r.log.Errorf("unable to write health status: %s", err)
+		}
+	})
+}
+
+type healthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// health returns why the connection is not usable, if it is not; unlike
+// `Ping()`, it does not talk to the server.
+func (r *Rabbit) health() error {
+	r.stateMutex.Lock()
+	state, stateErr := r.State(), r.stateErr
+	r.stateMutex.Unlock()
+
+	switch {
+	case state == StateClosed:
+		return ErrShutdown
+	case state == StateReconnecting && stateErr != nil:
+		return fmt.Errorf("reconnecting: %w", withSentinel(ErrNotConnected, stateErr))
+	case state == StateReconnecting:
+		return fmt.Errorf("reconnecting: %w", ErrNotConnected)
+	}
+
+	// The connection is being replaced if the lock cannot be acquired
+	if !r.ProducerRWMutex.TryRLock() {
+		return fmt.Errorf("reconnecting: %w", ErrNotConnected)
+	}
+
+	defer r.ProducerRWMutex.RUnlock()
+
+	if r.Conn == nil || r.Conn.IsClosed() {
+		return fmt.Errorf("connection is closed: %w", ErrNotConnected)
+	}
+
+	return nil
+}
+
+// WaitForConnection blocks until the library is connected to the server (ie.
+// it returns immediately unless a reconnect is in progress), so that callers
+// can gate startup or hold back publishing while reconnecting. It fails with
+// `ErrShutdown` if the library is closed meanwhile, or with an error wrapping
+// `ErrNotConnected` and the context error if ctx is done first.
+func (r *Rabbit) WaitForConnection(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for {
+		if r.closed() {
+			return ErrShutdown
+		}
+
+		r.stateMutex.Lock()
+		connected := r.connected
+		r.stateMutex.Unlock()
+
+		if connected == nil {
+			return nil
+		}
+
+		select {
+		case <-connected:
+		case <-r.shutdown:
+			return ErrShutdown
+		case <-ctx.Done():
+			return fmt.Errorf("unable to wait for connection: %w", withSentinel(ErrNotConnected, ctx.Err()))
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package jsonschema validates message bodies against JSON Schemas, for use
+// as `rabbit.Options.SchemaValidator`. Schemas are registered by message type
+// or routing key; the message type takes precedence when both match.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	schema "github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/batchcorp/rabbit"
+)
+
+var _ rabbit.SchemaValidator = (*Validator)(nil)
+
+// ErrNoSchema is returned when validating a message with no schema
+// registered, if `Options.RequireSchema` is set.
+var ErrNoSchema = errors.New("no schema registered for message")
+
+// Options determines how the validator behaves and should be passed in via
+// `New()`.
+type Options struct {
+	// Optional; JSON Schema documents keyed by message type or routing key
+	Schemas map[string]string
+
+	// Whether messages with no schema registered are invalid; by default they
+	// are not validated
+	RequireSchema bool
+}
+
+// Validator holds the compiled schemas; it is instantiated via `New()`.
+type Validator struct {
+	Options *Options
+
+	schemas map[string]*schema.Schema
+	mutex   *sync.RWMutex
+}
+
+// New is used for instantiating the validator, compiling the schemas in the
+// Options.
+func New(opts *Options) (*Validator, error) {
+	if err := ValidateOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	v := &Validator{
+		Options: opts,
+		schemas: make(map[string]*schema.Schema),
+		mutex:   &sync.RWMutex{},
+	}
+
+	for key, document := range opts.Schemas {
+		if err := v.Register(key, document); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// ValidateOptions validates the options and applies defaults.
+func ValidateOptions(opts *Options) error {
+	if opts == nil {
+		return errors.New("Options cannot be nil")
+	}
+
+	for key := range opts.Schemas {
+		if key == "" {
+			return errors.New("Schemas cannot contain an empty key")
+		}
+	}
+
+	return nil
+}
+
+// Register compiles the JSON Schema document and registers it for the given
+// message type or routing key, replacing any previously registered one.
+func (v *Validator) Register(key, document string) error {
+	if key == "" {
+		return errors.New("key cannot be empty")
+	}
+
+	compiled, err := schema.CompileString(key+".json", document)
+	if err != nil {
+		return fmt.Errorf("unable to compile schema '%s': %w", key, err)
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.schemas[key] = compiled
+
+	return nil
+}
+
+// ValidateMessage returns an error if the body is not JSON conforming to the
+// schema registered for the message type or, failing that, the routing key.
+func (v *Validator) ValidateMessage(routingKey, messageType string, body []byte) error {
+	compiled, key := v.lookup(routingKey, messageType)
+	if compiled == nil {
+		if v.Options.RequireSchema {
+			return fmt.Errorf("message type '%s', routing key '%s': %w", messageType, routingKey, ErrNoSchema)
+		}
+
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var doc interface{}
+
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("unable to decode body as JSON: %w", err)
+	}
+
+	if err := compiled.Validate(doc); err != nil {
+		return fmt.Errorf("schema '%s': %s", key, strings.TrimSpace(err.Error()))
+	}
+
+	return nil
+}
+
+func (v *Validator) lookup(routingKey, messageType string) (*schema.Schema, string) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	if compiled, ok := v.schemas[messageType]; ok && messageType != "" {
+		return compiled, messageType
+	}
+
+	if compiled, ok := v.schemas[routingKey]; ok && routingKey != "" {
+		return compiled, routingKey
+	}
+
+	return nil, ""
+}
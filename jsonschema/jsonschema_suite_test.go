@@ -0,0 +1,14 @@
+package jsonschema
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestJsonschemaSuite(t *testing.T) {
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Jsonschema Suite")
+}
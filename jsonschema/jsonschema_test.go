@@ -0,0 +1,68 @@
+package jsonschema
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "quantity"],
+	"properties": {
+		"id": {"type": "string"},
+		"quantity": {"type": "integer", "minimum": 1}
+	}
+}`
+
+var _ = Describe("Jsonschema", func() {
+	var validator *Validator
+
+	BeforeEach(func() {
+		var err error
+
+		validator, err = New(&Options{
+			Schemas: map[string]string{"order.created": orderSchema},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("accepts conforming messages", func() {
+		Expect(validator.ValidateMessage("", "order.created", []byte(`{"id": "1", "quantity": 2}`))).To(Succeed())
+	})
+
+	It("rejects messages violating the schema", func() {
+		err := validator.ValidateMessage("", "order.created", []byte(`{"id": "1", "quantity": 0}`))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("order.created"))
+
+		Expect(validator.ValidateMessage("", "order.created", []byte(`not json`))).ToNot(Succeed())
+	})
+
+	It("looks schemas up by message type first, then routing key", func() {
+		Expect(validator.Register("orders", `{"type": "array"}`)).To(Succeed())
+
+		Expect(validator.ValidateMessage("orders", "", []byte(`[]`))).To(Succeed())
+		Expect(validator.ValidateMessage("orders", "", []byte(`{}`))).ToNot(Succeed())
+		Expect(validator.ValidateMessage("orders", "order.created", []byte(`{"id": "1", "quantity": 1}`))).To(Succeed())
+	})
+
+	It("skips messages with no schema unless RequireSchema is set", func() {
+		Expect(validator.ValidateMessage("other", "other", []byte(`anything`))).To(Succeed())
+
+		validator.Options.RequireSchema = true
+
+		err := validator.ValidateMessage("other", "other", []byte(`{}`))
+		Expect(errors.Is(err, ErrNoSchema)).To(BeTrue())
+	})
+
+	It("errors with invalid schemas or options", func() {
+		_, err := New(&Options{Schemas: map[string]string{"bad": `{"type": 1}`}})
+		Expect(err).To(HaveOccurred())
+
+		Expect(ValidateOptions(nil)).To(MatchError("Options cannot be nil"))
+		Expect(ValidateOptions(&Options{Schemas: map[string]string{"": "{}"}})).
+			To(MatchError("Schemas cannot contain an empty key"))
+	})
+})
@@ -0,0 +1,248 @@
+// Package kubernetes discovers RabbitMQ nodes via the EndpointSlices of a
+// Kubernetes Service (such as the one created by the RabbitMQ cluster
+// operator), for use as `rabbit.Options.Discoverer`.
+//
+// It talks to the Kubernetes API directly and, by default, authenticates
+// with the pod's service account, which needs to be allowed to list
+// EndpointSlices in the namespace of the Service.
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/batchcorp/rabbit"
+)
+
+const (
+	// DefaultAPIServer is the address of the Kubernetes API from within a pod
+	DefaultAPIServer = "https://kubernetes.default.svc"
+
+	// DefaultPortName is the name of the AMQP port of the Services created by
+	// the RabbitMQ cluster operator
+	DefaultPortName = "amqp"
+
+	// DefaultTimeout is the timeout of the HTTP client used when none is
+	// provided in the Options
+	DefaultTimeout = 10 * time.Second
+
+	// ServiceAccountDir is where the credentials of the pod's service account
+	// are mounted
+	ServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+var _ rabbit.Discoverer = (*Discoverer)(nil)
+
+// Options determines how the discoverer behaves and should be passed in via
+// `New()`.
+type Options struct {
+	// Required; name of the Service fronting the RabbitMQ nodes
+	Service string
+
+	// Namespace of the Service; the pod's namespace if unset
+	Namespace string
+
+	// Name of the Service port to connect to; DefaultPortName if unset
+	PortName string
+
+	// Address of the Kubernetes API; DefaultAPIServer if unset
+	APIServer string
+
+	// Bearer token used for authenticating with the API; the pod's service
+	// account token (re-read on every request, as it is rotated) if unset
+	Token string
+
+	// Optional; a client trusting the pod's service account CA (with
+	// `DefaultTimeout`) is used if unset
+	HTTPClient *http.Client
+}
+
+// Discoverer lists the addresses of the ready endpoints of a Service; it is
+// instantiated via `New()`.
+type Discoverer struct {
+	Options *Options
+}
+
+type endpointSliceList struct {
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+// New is used for instantiating the discoverer.
+func New(opts *Options) (*Discoverer, error) {
+	if err := ValidateOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return &Discoverer{
+		Options: opts,
+	}, nil
+}
+
+// ValidateOptions validates the options and applies defaults; outside of a
+// pod, Namespace, Token and APIServer must be set.
+func ValidateOptions(opts *Options) error {
+	if opts == nil {
+		return errors.New("Options cannot be nil")
+	}
+
+	if opts.Service == "" {
+		return errors.New("Service cannot be empty")
+	}
+
+	if opts.Namespace == "" {
+		namespace, err := os.ReadFile(ServiceAccountDir + "/namespace")
+		if err != nil {
+			return fmt.Errorf("Namespace is unset and unable to read the pod's namespace: %w", err)
+		}
+
+		opts.Namespace = strings.TrimSpace(string(namespace))
+	}
+
+	if opts.PortName == "" {
+		opts.PortName = DefaultPortName
+	}
+
+	if opts.APIServer == "" {
+		opts.APIServer = DefaultAPIServer
+	}
+
+	if opts.HTTPClient == nil {
+		client, err := inClusterClient()
+		if err != nil {
+			return fmt.Errorf("HTTPClient is unset and unable to create in-cluster client: %w", err)
+		}
+
+		opts.HTTPClient = client
+	}
+
+	return nil
+}
+
+// Discover returns the addresses ("host:port") of the ready endpoints of the
+// Service.
+func (d *Discoverer) Discover(ctx context.Context) ([]string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	token := d.Options.Token
+
+	if token == "" {
+		data, err := os.ReadFile(ServiceAccountDir + "/token")
+		if err != nil {
+			return nil, fmt.Errorf("unable to read service account token: %w", err)
+		}
+
+		token = strings.TrimSpace(string(data))
+	}
+
+	endpoint := strings.TrimSuffix(d.Options.APIServer, "/") +
+		"/apis/discovery.k8s.io/v1/namespaces/" + url.PathEscape(d.Options.Namespace) +
+		"/endpointslices?labelSelector=" + url.QueryEscape("kubernetes.io/service-name="+d.Options.Service)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := d.Options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list endpoint slices: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kubernetes API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var slices endpointSliceList
+
+	if err := json.Unmarshal(body, &slices); err != nil {
+		return nil, fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	var addrs []string
+
+	for _, slice := range slices.Items {
+		port := 0
+
+		for _, p := range slice.Ports {
+			if p.Name == d.Options.PortName {
+				port = p.Port
+			}
+		}
+
+		if port == 0 {
+			continue
+		}
+
+		for _, endpoint := range slice.Endpoints {
+			// An unknown readiness is to be interpreted as ready
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+
+			for _, addr := range endpoint.Addresses {
+				addrs = append(addrs, net.JoinHostPort(addr, strconv.Itoa(port)))
+			}
+		}
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no ready endpoints with port '%s' found for service '%s'", d.Options.PortName, d.Options.Service)
+	}
+
+	return addrs, nil
+}
+
+func inClusterClient() (*http.Client, error) {
+	ca, err := os.ReadFile(ServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("unable to parse service account CA")
+	}
+
+	return &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}, nil
+}
@@ -0,0 +1,14 @@
+package kubernetes
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestKubernetesSuite(t *testing.T) {
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Kubernetes Suite")
+}
@@ -0,0 +1,92 @@
+package kubernetes
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Kubernetes", func() {
+	var (
+		server     *httptest.Server
+		discoverer *Discoverer
+		requests   []*http.Request
+		response   string
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		response = `{"items":[{
+			"endpoints":[
+				{"addresses":["10.0.0.1"],"conditions":{"ready":true}},
+				{"addresses":["10.0.0.2"],"conditions":{"ready":false}},
+				{"addresses":["10.0.0.3"],"conditions":{}}
+			],
+			"ports":[{"name":"management","port":15672},{"name":"amqp","port":5672}]
+		}]}`
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req)
+			w.Write([]byte(response))
+		}))
+
+		var err error
+
+		discoverer, err = New(&Options{
+			Service:    "rabbitmq",
+			Namespace:  "messaging",
+			APIServer:  server.URL,
+			Token:      "token",
+			HTTPClient: server.Client(),
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("New", func() {
+		It("applies defaults", func() {
+			Expect(discoverer.Options.PortName).To(Equal(DefaultPortName))
+		})
+
+		It("errors without a Service", func() {
+			_, err := New(&Options{Namespace: "messaging", HTTPClient: server.Client()})
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Service cannot be empty"))
+		})
+	})
+
+	Describe("Discover", func() {
+		It("lists the endpoint slices of the service", func() {
+			_, err := discoverer.Discover(nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].URL.Path).To(Equal("/apis/discovery.k8s.io/v1/namespaces/messaging/endpointslices"))
+			Expect(requests[0].URL.Query().Get("labelSelector")).To(Equal("kubernetes.io/service-name=rabbitmq"))
+			Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer token"))
+		})
+
+		It("returns the addresses of ready endpoints", func() {
+			addrs, err := discoverer.Discover(nil)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addrs).To(Equal([]string{"10.0.0.1:5672", "10.0.0.3:5672"}))
+		})
+
+		It("errors if there are no ready endpoints", func() {
+			response = `{"items":[]}`
+
+			_, err := discoverer.Discover(nil)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("no ready endpoints"))
+		})
+	})
+})
@@ -0,0 +1,276 @@
+// Package management is a minimal client for the RabbitMQ management plugin's
+// HTTP API, covering the operational queries that applications using the
+// `rabbit` library typically need (queue depths, connections, policies).
+package management
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the timeout of the HTTP client used when none is
+	// provided in the Options
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultVhost is the default virtual host
+	DefaultVhost = "/"
+)
+
+// Options determines how the management client behaves and should be passed
+// in via `New()`.
+type Options struct {
+	// Required; format "http://host:15672"
+	URL string
+
+	// Required
+	Username string
+
+	// Required
+	Password string
+
+	// Optional; a client with `DefaultTimeout` is used if unset
+	HTTPClient *http.Client
+}
+
+// Client is the management HTTP API client; it is instantiated via `New()`.
+type Client struct {
+	Options *Options
+}
+
+// Queue holds the (subset of) queue information returned by the API.
+type Queue struct {
+	Name                   string                 `json:"name"`
+	Vhost                  string                 `json:"vhost"`
+	Durable                bool                   `json:"durable"`
+	AutoDelete             bool                   `json:"auto_delete"`
+	Exclusive              bool                   `json:"exclusive"`
+	Arguments              map[string]interface{} `json:"arguments"`
+	Type                   string                 `json:"type"`
+	State                  string                 `json:"state"`
+	Node                   string                 `json:"node"`
+	Consumers              int                    `json:"consumers"`
+	Messages               int                    `json:"messages"`
+	MessagesReady          int                    `json:"messages_ready"`
+	MessagesUnacknowledged int                    `json:"messages_unacknowledged"`
+}
+
+// Connection holds the (subset of) connection information returned by the API.
+type Connection struct {
+	Name     string `json:"name"`
+	Vhost    string `json:"vhost"`
+	User     string `json:"user"`
+	State    string `json:"state"`
+	Node     string `json:"node"`
+	Protocol string `json:"protocol"`
+	PeerHost string `json:"peer_host"`
+	PeerPort int    `json:"peer_port"`
+	Channels int    `json:"channels"`
+}
+
+// Policy describes a policy to be set on a virtual host.
+type Policy struct {
+	// Required; regular expression matching the names of queues/exchanges
+	Pattern string `json:"pattern"`
+
+	// Required; eg. {"max-length": 1000, "dead-letter-exchange": "dlx"}
+	Definition map[string]interface{} `json:"definition"`
+
+	// Optional; higher priority policies take precedence
+	Priority int `json:"priority"`
+
+	// Optional; one of "queues", "exchanges", "all" (default)
+	ApplyTo string `json:"apply-to,omitempty"`
+}
+
+// Error is returned when the API responds with a non-2xx status code.
+type Error struct {
+	StatusCode int
+	Reason     string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("management API returned status %d: %s", e.StatusCode, e.Reason)
+}
+
+// New is used for instantiating the client.
+func New(opts *Options) (*Client, error) {
+	if err := ValidateOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return &Client{
+		Options: opts,
+	}, nil
+}
+
+// ValidateOptions validates the options and applies defaults.
+func ValidateOptions(opts *Options) error {
+	if opts == nil {
+		return errors.New("Options cannot be nil")
+	}
+
+	if opts.URL == "" {
+		return errors.New("URL cannot be empty")
+	}
+
+	if _, err := url.Parse(opts.URL); err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	if opts.Username == "" {
+		return errors.New("Username cannot be empty")
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return nil
+}
+
+// ListQueues returns all the queues in the given virtual host, or in all
+// virtual hosts if `vhost` is empty.
+func (c *Client) ListQueues(ctx context.Context, vhost string) ([]Queue, error) {
+	path := "/api/queues"
+	if vhost != "" {
+		path += "/" + url.PathEscape(vhost)
+	}
+
+	queues := make([]Queue, 0)
+
+	if err := c.do(ctx, http.MethodGet, path, nil, &queues); err != nil {
+		return nil, fmt.Errorf("unable to list queues: %w", err)
+	}
+
+	return queues, nil
+}
+
+// GetQueue returns the information (including depth) of the given queue.
+func (c *Client) GetQueue(ctx context.Context, vhost, name string) (*Queue, error) {
+	queue := &Queue{}
+
+	if err := c.do(ctx, http.MethodGet, "/api/queues/"+url.PathEscape(vhostOrDefault(vhost))+"/"+url.PathEscape(name), nil, queue); err != nil {
+		return nil, fmt.Errorf("unable to get queue '%s': %w", name, err)
+	}
+
+	return queue, nil
+}
+
+// QueueDepth returns the total number of messages (ready and unacknowledged)
+// in the given queue.
+func (c *Client) QueueDepth(ctx context.Context, vhost, name string) (int, error) {
+	queue, err := c.GetQueue(ctx, vhost, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return queue.Messages, nil
+}
+
+// ListConnections returns all the open connections.
+func (c *Client) ListConnections(ctx context.Context) ([]Connection, error) {
+	connections := make([]Connection, 0)
+
+	if err := c.do(ctx, http.MethodGet, "/api/connections", nil, &connections); err != nil {
+		return nil, fmt.Errorf("unable to list connections: %w", err)
+	}
+
+	return connections, nil
+}
+
+// SetPolicy creates or updates the named policy in the given virtual host.
+func (c *Client) SetPolicy(ctx context.Context, vhost, name string, policy Policy) error {
+	if err := c.do(ctx, http.MethodPut, c.policyPath(vhost, name), policy, nil); err != nil {
+		return fmt.Errorf("unable to set policy '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+// DeletePolicy deletes the named policy from the given virtual host.
+func (c *Client) DeletePolicy(ctx context.Context, vhost, name string) error {
+	if err := c.do(ctx, http.MethodDelete, c.policyPath(vhost, name), nil, nil); err != nil {
+		return fmt.Errorf("unable to delete policy '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+func (c *Client) policyPath(vhost, name string) string {
+	return "/api/policies/" + url.PathEscape(vhostOrDefault(vhost)) + "/" + url.PathEscape(name)
+}
+
+// do performs the request, encoding `in` (if any) as the JSON request body and
+// decoding the JSON response body into `out` (if any).
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var body io.Reader
+
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("unable to marshal request: %w", err)
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(c.Options.URL, "/")+path, body)
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(c.Options.Username, c.Options.Password)
+	req.Header.Set("Accept", "application/json")
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Options.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to perform request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		reason, _ := io.ReadAll(resp.Body)
+
+		return &Error{
+			StatusCode: resp.StatusCode,
+			Reason:     strings.TrimSpace(string(reason)),
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	return nil
+}
+
+func vhostOrDefault(vhost string) string {
+	if vhost == "" {
+		return DefaultVhost
+	}
+
+	return vhost
+}
@@ -0,0 +1,14 @@
+package management
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestManagementSuite(t *testing.T) {
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Management Suite")
+}
@@ -0,0 +1,137 @@
+package management
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Management", func() {
+	var (
+		server   *httptest.Server
+		client   *Client
+		requests []*http.Request
+		bodies   []map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		bodies = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req)
+
+			if req.Body != nil {
+				body := map[string]interface{}{}
+				json.NewDecoder(req.Body).Decode(&body)
+				bodies = append(bodies, body)
+			}
+
+			switch req.URL.EscapedPath() {
+			case "/api/queues/%2F":
+				w.Write([]byte(`[{"name":"queue1","vhost":"/","messages":3,"consumers":1}]`))
+			case "/api/queues/%2F/queue1":
+				w.Write([]byte(`{"name":"queue1","vhost":"/","messages":3,"messages_ready":2,"messages_unacknowledged":1}`))
+			case "/api/connections":
+				w.Write([]byte(`[{"name":"127.0.0.1:1234 -> 127.0.0.1:5672","user":"guest","channels":2}]`))
+			case "/api/policies/%2F/max-length":
+				w.WriteHeader(http.StatusCreated)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"Object Not Found","reason":"Not Found"}`))
+			}
+		}))
+
+		var err error
+
+		client, err = New(&Options{
+			URL:      server.URL,
+			Username: "guest",
+			Password: "guest",
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("New", func() {
+		It("should error with missing options", func() {
+			_, err := New(nil)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("cannot be nil"))
+		})
+
+		It("should error with missing URL", func() {
+			_, err := New(&Options{Username: "guest"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("URL cannot be empty"))
+		})
+	})
+
+	Describe("ListQueues", func() {
+		It("returns the queues of the given vhost", func() {
+			queues, err := client.ListQueues(nil, "/")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(queues).To(HaveLen(1))
+			Expect(queues[0].Name).To(Equal("queue1"))
+			Expect(queues[0].Messages).To(Equal(3))
+
+			user, pass, ok := requests[0].BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(user).To(Equal("guest"))
+			Expect(pass).To(Equal("guest"))
+		})
+	})
+
+	Describe("QueueDepth", func() {
+		It("returns the number of messages in the queue", func() {
+			depth, err := client.QueueDepth(nil, "", "queue1")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(depth).To(Equal(3))
+		})
+
+		It("returns an API error for unknown queues", func() {
+			_, err := client.QueueDepth(nil, "", "unknown")
+
+			Expect(err).To(HaveOccurred())
+
+			var apiErr *Error
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.StatusCode).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("ListConnections", func() {
+		It("returns the open connections", func() {
+			connections, err := client.ListConnections(nil)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connections).To(HaveLen(1))
+			Expect(connections[0].Channels).To(Equal(2))
+		})
+	})
+
+	Describe("SetPolicy", func() {
+		It("sends the policy definition", func() {
+			err := client.SetPolicy(nil, "", "max-length", Policy{
+				Pattern:    "^queue",
+				Definition: map[string]interface{}{"max-length": 1000},
+				ApplyTo:    "queues",
+			})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requests[0].Method).To(Equal(http.MethodPut))
+			Expect(bodies[0]).To(HaveKeyWithValue("pattern", "^queue"))
+			Expect(bodies[0]).To(HaveKeyWithValue("apply-to", "queues"))
+		})
+	})
+})
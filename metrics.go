@@ -0,0 +1,37 @@
+package rabbit
+
+import (
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Metrics receives measurements from the library, for exporting them to a
+// metrics backend; see the otel subpackage for an OpenTelemetry implementation.
+// Methods are called synchronously, so they should not block.
+type Metrics interface {
+	// MessageConsumed is called after the handler has processed a message,
+	// with how long it took and the error it returned (if any)
+	MessageConsumed(msg amqp.Delivery, duration time.Duration, err error)
+
+	// MessagePublished is called after every publish, with its error (if any)
+	MessagePublished(exchange, routingKey string, err error)
+
+	// Reconnected is called every time the library reconnects to the server
+	Reconnected()
+}
+
+// recordPublish counts a publish (see `Stats()`) and reports it to
+// `Options.Metrics`.
+func (r *Rabbit) recordPublish(exchange, routingKey string, err error) {
+	atomic.AddInt64(&r.published, 1)
+
+	if err != nil {
+		atomic.AddInt64(&r.publishErrors, 1)
+	}
+
+	if r.Options.Metrics != nil {
+		r.Options.Metrics.MessagePublished(exchange, routingKey, err)
+	}
+}
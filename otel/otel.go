@@ -0,0 +1,171 @@
+// Package otel exports the library's measurements as OpenTelemetry metrics,
+// for use as `rabbit.Options.Metrics`:
+//
+//   - rabbit.messages.consumed: messages handled, by exchange and outcome
+//   - rabbit.messages.published: publishes, by exchange and outcome
+//   - rabbit.handler.duration: time spent by handlers, in seconds
+//   - rabbit.messages.latency: time from publishing to being handled, in
+//     seconds (note that message timestamps have a resolution of one second)
+//   - rabbit.reconnects: reconnections to the server
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/batchcorp/rabbit"
+)
+
+const (
+	// DefaultMeterName is the name of the meter the instruments are created
+	// with, if none is provided in the Options
+	DefaultMeterName = "github.com/batchcorp/rabbit"
+
+	// OutcomeSuccess and OutcomeError are the values of the "outcome"
+	// attribute
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+var _ rabbit.Metrics = (*Metrics)(nil)
+
+// Options determines how the metrics are recorded and should be passed in via
+// `New()`.
+type Options struct {
+	// Optional; the global meter provider is used if unset
+	MeterProvider metric.MeterProvider
+
+	// Name of the meter; DefaultMeterName if unset
+	MeterName string
+}
+
+// Metrics records the library's measurements via OpenTelemetry instruments;
+// it is instantiated via `New()`.
+type Metrics struct {
+	Options *Options
+
+	consumed        metric.Int64Counter
+	published       metric.Int64Counter
+	handlerDuration metric.Float64Histogram
+	latency         metric.Float64Histogram
+	reconnects      metric.Int64Counter
+}
+
+// New is used for instantiating the metrics, creating their instruments.
+func New(opts *Options) (*Metrics, error) {
+	if err := ValidateOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	meter := opts.MeterProvider.Meter(opts.MeterName)
+
+	m := &Metrics{
+		Options: opts,
+	}
+
+	var err error
+
+	if m.consumed, err = meter.Int64Counter(
+		"rabbit.messages.consumed",
+		metric.WithDescription("Number of messages handled"),
+		metric.WithUnit("{message}"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create consumed counter: %w", err)
+	}
+
+	if m.published, err = meter.Int64Counter(
+		"rabbit.messages.published",
+		metric.WithDescription("Number of messages published"),
+		metric.WithUnit("{message}"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create published counter: %w", err)
+	}
+
+	if m.handlerDuration, err = meter.Float64Histogram(
+		"rabbit.handler.duration",
+		metric.WithDescription("Time spent handling messages"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create handler duration histogram: %w", err)
+	}
+
+	if m.latency, err = meter.Float64Histogram(
+		"rabbit.messages.latency",
+		metric.WithDescription("Time from publishing messages to having them handled"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create latency histogram: %w", err)
+	}
+
+	if m.reconnects, err = meter.Int64Counter(
+		"rabbit.reconnects",
+		metric.WithDescription("Number of reconnections to the server"),
+		metric.WithUnit("{reconnect}"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create reconnects counter: %w", err)
+	}
+
+	return m, nil
+}
+
+// ValidateOptions validates the options and applies defaults.
+func ValidateOptions(opts *Options) error {
+	if opts == nil {
+		return errors.New("Options cannot be nil")
+	}
+
+	if opts.MeterProvider == nil {
+		opts.MeterProvider = otel.GetMeterProvider()
+	}
+
+	if opts.MeterName == "" {
+		opts.MeterName = DefaultMeterName
+	}
+
+	return nil
+}
+
+// MessageConsumed records a handled message, how long its handler took and,
+// if the message is timestamped, its end-to-end latency.
+func (m *Metrics) MessageConsumed(msg amqp.Delivery, duration time.Duration, err error) {
+	ctx := context.Background()
+	attrs := metric.WithAttributes(
+		attribute.String("exchange", msg.Exchange),
+		attribute.String("outcome", outcome(err)),
+	)
+
+	m.consumed.Add(ctx, 1, attrs)
+	m.handlerDuration.Record(ctx, duration.Seconds(), attrs)
+
+	if !msg.Timestamp.IsZero() {
+		m.latency.Record(ctx, time.Since(msg.Timestamp).Seconds(), attrs)
+	}
+}
+
+// MessagePublished records a publish.
+func (m *Metrics) MessagePublished(exchange, routingKey string, err error) {
+	m.published.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("exchange", exchange),
+		attribute.String("outcome", outcome(err)),
+	))
+}
+
+// Reconnected records a reconnection.
+func (m *Metrics) Reconnected() {
+	m.reconnects.Add(context.Background(), 1)
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+
+	return OutcomeSuccess
+}
@@ -0,0 +1,115 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var _ = Describe("Otel", func() {
+	var (
+		reader  *sdkmetric.ManualReader
+		metrics *Metrics
+	)
+
+	BeforeEach(func() {
+		reader = sdkmetric.NewManualReader()
+
+		var err error
+
+		metrics, err = New(&Options{
+			MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	collect := func() map[string]metricdata.Aggregation {
+		var rm metricdata.ResourceMetrics
+		Expect(reader.Collect(context.Background(), &rm)).To(Succeed())
+
+		collected := make(map[string]metricdata.Aggregation)
+
+		for _, sm := range rm.ScopeMetrics {
+			Expect(sm.Scope.Name).To(Equal(DefaultMeterName))
+
+			for _, m := range sm.Metrics {
+				collected[m.Name] = m.Data
+			}
+		}
+
+		return collected
+	}
+
+	It("records consumed messages, handler duration and latency", func() {
+		msg := amqp.Delivery{
+			Exchange:  "orders",
+			Timestamp: time.Now().Add(-2 * time.Second),
+		}
+
+		metrics.MessageConsumed(msg, 100*time.Millisecond, nil)
+		metrics.MessageConsumed(msg, 200*time.Millisecond, errors.New("stuff broke"))
+
+		collected := collect()
+
+		consumed := collected["rabbit.messages.consumed"].(metricdata.Sum[int64])
+		Expect(consumed.DataPoints).To(HaveLen(2))
+
+		for _, dp := range consumed.DataPoints {
+			Expect(dp.Value).To(Equal(int64(1)))
+			Expect(dp.Attributes.HasValue("exchange")).To(BeTrue())
+		}
+
+		duration := collected["rabbit.handler.duration"].(metricdata.Histogram[float64])
+		Expect(duration.DataPoints).To(HaveLen(2))
+
+		latency := collected["rabbit.messages.latency"].(metricdata.Histogram[float64])
+		Expect(latency.DataPoints).To(HaveLen(2))
+		Expect(latency.DataPoints[0].Sum).To(BeNumerically(">=", 2))
+	})
+
+	It("does not record the latency of messages without a timestamp", func() {
+		metrics.MessageConsumed(amqp.Delivery{}, time.Millisecond, nil)
+
+		Expect(collect()).ToNot(HaveKey("rabbit.messages.latency"))
+	})
+
+	It("records publishes by outcome", func() {
+		metrics.MessagePublished("orders", "orders.created", nil)
+		metrics.MessagePublished("orders", "orders.created", nil)
+		metrics.MessagePublished("orders", "orders.created", errors.New("stuff broke"))
+
+		published := collect()["rabbit.messages.published"].(metricdata.Sum[int64])
+
+		values := make(map[string]int64)
+
+		for _, dp := range published.DataPoints {
+			outcome, _ := dp.Attributes.Value(attribute.Key("outcome"))
+			values[outcome.AsString()] = dp.Value
+		}
+
+		Expect(values).To(Equal(map[string]int64{OutcomeSuccess: 2, OutcomeError: 1}))
+	})
+
+	It("records reconnects", func() {
+		metrics.Reconnected()
+
+		reconnects := collect()["rabbit.reconnects"].(metricdata.Sum[int64])
+		Expect(reconnects.DataPoints).To(HaveLen(1))
+		Expect(reconnects.DataPoints[0].Value).To(Equal(int64(1)))
+	})
+
+	It("uses the global meter provider if unset", func() {
+		opts := &Options{}
+
+		Expect(ValidateOptions(opts)).To(Succeed())
+		Expect(opts.MeterProvider).ToNot(BeNil())
+		Expect(opts.MeterName).To(Equal(DefaultMeterName))
+	})
+})
@@ -0,0 +1,382 @@
+// Package outbox implements the transactional outbox pattern on top of
+// `database/sql`: messages are staged in a table within the same transaction
+// as the business data (see `Outbox.Stage()`), and a relay (see
+// `Outbox.Run()`) publishes the staged messages with publisher confirms,
+// deleting each row once the server has confirmed it. This way a message is
+// published if and only if the transaction commits.
+//
+// Delivery is at-least-once: should the relay stop between a confirm and the
+// deletion of the row, the message is published again. Run a single relay per
+// table, as rows are not locked while being relayed.
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/batchcorp/rabbit"
+)
+
+const (
+	// DefaultTable is the name of the outbox table, if none is provided in
+	// the Options
+	DefaultTable = "rabbit_outbox"
+
+	// DefaultBatchSize is the maximum number of messages relayed per query, if
+	// none is provided in the Options
+	DefaultBatchSize = 100
+
+	// DefaultPollInterval is how often the relay looks for staged messages
+	// when the table has been drained, if none is provided in the Options
+	DefaultPollInterval = time.Second
+)
+
+const (
+	// PlaceholderQuestion renders query parameters as "?" (eg. MySQL, SQLite)
+	PlaceholderQuestion Placeholder = 0
+	// PlaceholderDollar renders query parameters as "$1", "$2", ... (eg.
+	// PostgreSQL)
+	PlaceholderDollar Placeholder = 1
+)
+
+// Placeholder is the style of the query parameters of the database driver.
+type Placeholder int
+
+// Publisher publishes messages with confirms; it is implemented by
+// `*rabbit.Rabbit`.
+type Publisher interface {
+	PublishAndWait(ctx context.Context, routingKey string, body []byte, opts ...rabbit.PublishOption) (rabbit.PublishResult, error)
+}
+
+var _ Publisher = (*rabbit.Rabbit)(nil)
+
+// Options determines how the outbox behaves and should be passed in via
+// `New()`.
+type Options struct {
+	// Required; database the outbox table lives in
+	DB *sql.DB
+
+	// Required; messages are published to its configured exchange
+	Publisher Publisher
+
+	// Name of the outbox table (see `Schema()`); DefaultTable if unset
+	Table string
+
+	// Style of the query parameters; PlaceholderQuestion if unset
+	Placeholder Placeholder
+
+	// Maximum number of messages relayed per query; DefaultBatchSize if unset
+	BatchSize int
+
+	// How often to look for staged messages; DefaultPollInterval if unset
+	PollInterval time.Duration
+
+	// Optional; called with the errors encountered by `Run()`
+	OnError func(err error)
+}
+
+// Message is a message staged in the outbox.
+type Message struct {
+	RoutingKey string          `json:"routing_key"`
+	Publishing amqp.Publishing `json:"publishing"`
+}
+
+// Outbox stages messages and relays them to the server; it is instantiated
+// via `New()`.
+type Outbox struct {
+	Options *Options
+}
+
+// New is used for instantiating the outbox; the table must already exist
+// (see `Schema()`).
+func New(opts *Options) (*Outbox, error) {
+	if err := ValidateOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return &Outbox{
+		Options: opts,
+	}, nil
+}
+
+// ValidateOptions validates the options and applies defaults.
+func ValidateOptions(opts *Options) error {
+	if opts == nil {
+		return errors.New("Options cannot be nil")
+	}
+
+	if opts.DB == nil {
+		return errors.New("DB cannot be nil")
+	}
+
+	if opts.Publisher == nil {
+		return errors.New("Publisher cannot be nil")
+	}
+
+	if opts.Placeholder != PlaceholderQuestion && opts.Placeholder != PlaceholderDollar {
+		return fmt.Errorf("invalid Placeholder '%d'", opts.Placeholder)
+	}
+
+	if opts.BatchSize < 0 {
+		return errors.New("BatchSize cannot be negative")
+	}
+
+	if opts.PollInterval < 0 {
+		return errors.New("PollInterval cannot be negative")
+	}
+
+	if opts.Table == "" {
+		opts.Table = DefaultTable
+	}
+
+	if opts.BatchSize == 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	if opts.PollInterval == 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+
+	return nil
+}
+
+// Schema returns the statement creating the outbox table with the given name
+// (DefaultTable if empty); the column types are supported by PostgreSQL,
+// MySQL and SQLite alike.
+func Schema(table string) string {
+	if table == "" {
+		table = DefaultTable
+	}
+
+	return "CREATE TABLE IF NOT EXISTS " + table + " (\n" +
+		"\tid VARCHAR(64) NOT NULL PRIMARY KEY,\n" +
+		"\tcreated_at BIGINT NOT NULL,\n" +
+		"\tmessage TEXT NOT NULL\n" +
+		")"
+}
+
+// Stage inserts the message into the outbox table as part of the given
+// transaction; it is published by the relay once the transaction commits.
+// Header values are stored as JSON, so integers are restored as int64 and
+// binary values (as well as timestamps) as strings.
+func (o *Outbox) Stage(ctx context.Context, tx *sql.Tx, msg Message) error {
+	if tx == nil {
+		return errors.New("transaction cannot be nil")
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("unable to encode message: %w", err)
+	}
+
+	now := time.Now().UnixNano()
+
+	// Zero-padded so that IDs sort in the order they were staged in
+	id := fmt.Sprintf("%020d-%s", now, uuid.NewV4().String())
+
+	query := "INSERT INTO " + o.Options.Table + " (id, created_at, message) VALUES (" +
+		o.placeholders(3) + ")"
+
+	if _, err := tx.ExecContext(ctx, query, id, now, string(data)); err != nil {
+		return fmt.Errorf("unable to stage message: %w", err)
+	}
+
+	return nil
+}
+
+// Run relays the staged messages until ctx is cancelled; errors are passed to
+// `Options.OnError` (if set) and the messages retried on the next poll.
+func (o *Outbox) Run(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for {
+		n, err := o.Relay(ctx)
+		if err != nil && ctx.Err() == nil && o.Options.OnError != nil {
+			o.Options.OnError(err)
+		}
+
+		// More messages are likely to be waiting
+		if err == nil && n == o.Options.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(o.Options.PollInterval):
+		}
+	}
+}
+
+// Relay publishes (in the order they were staged) up to `Options.BatchSize`
+// messages, deleting each one once the server has confirmed it, and returns
+// how many were relayed. It stops at the first message that is not
+// confirmed, so that the following ones are not published ahead of it.
+func (o *Outbox) Relay(ctx context.Context) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	query := "SELECT id, message FROM " + o.Options.Table + " ORDER BY created_at, id LIMIT " +
+		strconv.Itoa(o.Options.BatchSize)
+
+	rows, err := o.Options.DB.QueryContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("unable to query outbox: %w", err)
+	}
+
+	type row struct {
+		id      string
+		message string
+	}
+
+	var staged []row
+
+	for rows.Next() {
+		var r row
+
+		if err := rows.Scan(&r.id, &r.message); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("unable to read outbox row: %w", err)
+		}
+
+		staged = append(staged, r)
+	}
+
+	// Don't hold on to the connection while publishing
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("unable to read outbox rows: %w", err)
+	}
+
+	for i, r := range staged {
+		msg, err := decodeMessage(r.message)
+		if err != nil {
+			return i, fmt.Errorf("unable to decode message '%s': %w", r.id, err)
+		}
+
+		if err := o.publish(ctx, msg); err != nil {
+			return i, fmt.Errorf("unable to relay message '%s': %w", r.id, err)
+		}
+
+		if _, err := o.Options.DB.ExecContext(ctx, "DELETE FROM "+o.Options.Table+" WHERE id = "+o.placeholders(1), r.id); err != nil {
+			return i, fmt.Errorf("unable to delete relayed message '%s': %w", r.id, err)
+		}
+	}
+
+	return len(staged), nil
+}
+
+// publish sends the message and waits for the server to confirm it.
+func (o *Outbox) publish(ctx context.Context, msg Message) error {
+	stored := msg.Publishing
+
+	result, err := o.Options.Publisher.PublishAndWait(ctx, msg.RoutingKey, stored.Body, func(p *amqp.Publishing) {
+		// Keep the library's defaults for the unset properties
+		deliveryMode, appID := p.DeliveryMode, p.AppId
+
+		*p = stored
+
+		if p.DeliveryMode == 0 {
+			p.DeliveryMode = deliveryMode
+		}
+
+		if p.AppId == "" {
+			p.AppId = appID
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// placeholders returns the first n query parameters, separated by commas.
+func (o *Outbox) placeholders(n int) string {
+	params := make([]string, n)
+
+	for i := range params {
+		if o.Options.Placeholder == PlaceholderDollar {
+			params[i] = "$" + strconv.Itoa(i+1)
+		} else {
+			params[i] = "?"
+		}
+	}
+
+	return strings.Join(params, ", ")
+}
+
+func decodeMessage(data string) (Message, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	decoder.UseNumber()
+
+	var msg Message
+
+	if err := decoder.Decode(&msg); err != nil {
+		return Message{}, err
+	}
+
+	msg.Publishing.Headers = normalizeTable(msg.Publishing.Headers)
+
+	return msg, nil
+}
+
+// normalizeTable converts the decoded header values into values the server
+// accepts (ie. json.Number into int64 or float64, nested maps into
+// amqp.Table).
+func normalizeTable(table amqp.Table) amqp.Table {
+	if len(table) == 0 {
+		return nil
+	}
+
+	normalized := amqp.Table{}
+
+	for k, v := range table {
+		normalized[k] = normalizeValue(v)
+	}
+
+	return normalized
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := value.Float64()
+
+		return f
+	case map[string]interface{}:
+		return normalizeTable(value)
+	case []interface{}:
+		values := make([]interface{}, len(value))
+
+		for i := range value {
+			values[i] = normalizeValue(value[i])
+		}
+
+		return values
+	}
+
+	return v
+}
@@ -0,0 +1,399 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/batchcorp/rabbit"
+)
+
+var _ = Describe("Outbox", func() {
+	var (
+		db        *sql.DB
+		store     *fakeStore
+		publisher *fakePublisher
+		outbox    *Outbox
+	)
+
+	BeforeEach(func() {
+		dsn := uuid.NewV4().String()
+		store = fakeStores.get(dsn)
+
+		var err error
+
+		db, err = sql.Open("outbox-fake", dsn)
+		Expect(err).ToNot(HaveOccurred())
+
+		publisher = &fakePublisher{}
+
+		outbox, err = New(&Options{
+			DB:           db,
+			Publisher:    publisher,
+			PollInterval: 10 * time.Millisecond,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		db.Close()
+	})
+
+	stage := func(routingKey string, body string) {
+		tx, err := db.Begin()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(outbox.Stage(context.Background(), tx, Message{
+			RoutingKey: routingKey,
+			Publishing: amqp.Publishing{
+				Headers: amqp.Table{"attempt": int64(1)},
+				Body:    []byte(body),
+			},
+		})).To(Succeed())
+
+		Expect(tx.Commit()).To(Succeed())
+	}
+
+	Context("ValidateOptions", func() {
+		It("applies defaults", func() {
+			opts := &Options{DB: db, Publisher: publisher}
+
+			Expect(ValidateOptions(opts)).To(Succeed())
+			Expect(opts.Table).To(Equal(DefaultTable))
+			Expect(opts.BatchSize).To(Equal(DefaultBatchSize))
+			Expect(opts.PollInterval).To(Equal(DefaultPollInterval))
+		})
+
+		It("errors with missing or invalid options", func() {
+			Expect(ValidateOptions(nil)).To(MatchError("Options cannot be nil"))
+			Expect(ValidateOptions(&Options{Publisher: publisher})).To(MatchError("DB cannot be nil"))
+			Expect(ValidateOptions(&Options{DB: db})).To(MatchError("Publisher cannot be nil"))
+			Expect(ValidateOptions(&Options{DB: db, Publisher: publisher, Placeholder: 2})).
+				To(MatchError("invalid Placeholder '2'"))
+			Expect(ValidateOptions(&Options{DB: db, Publisher: publisher, BatchSize: -1})).
+				To(MatchError("BatchSize cannot be negative"))
+		})
+	})
+
+	Context("Schema", func() {
+		It("creates the named table", func() {
+			Expect(Schema("")).To(HavePrefix("CREATE TABLE IF NOT EXISTS " + DefaultTable + " ("))
+			Expect(Schema("events_outbox")).To(ContainSubstring("events_outbox"))
+		})
+	})
+
+	Context("Stage", func() {
+		It("inserts the message within the transaction", func() {
+			tx, err := db.Begin()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(outbox.Stage(context.Background(), tx, Message{RoutingKey: "key"})).To(Succeed())
+			Expect(store.len()).To(Equal(0))
+
+			Expect(tx.Rollback()).To(Succeed())
+			Expect(store.len()).To(Equal(0))
+
+			stage("key", "committed")
+			Expect(store.len()).To(Equal(1))
+		})
+
+		It("renders placeholders as per the options", func() {
+			outbox.Options.Placeholder = PlaceholderDollar
+			stage("key", "body")
+
+			Expect(store.lastQuery()).To(ContainSubstring("VALUES ($1, $2, $3)"))
+		})
+	})
+
+	Context("Relay", func() {
+		It("publishes staged messages in order and deletes them", func() {
+			stage("first", "1")
+			stage("second", "2")
+
+			n, err := outbox.Relay(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(2))
+			Expect(store.len()).To(Equal(0))
+
+			published := publisher.messages()
+			Expect(published).To(HaveLen(2))
+			Expect(published[0].RoutingKey).To(Equal("first"))
+			Expect(string(published[0].Publishing.Body)).To(Equal("1"))
+			Expect(published[0].Publishing.Headers).To(Equal(amqp.Table{"attempt": int64(1)}))
+			Expect(published[1].RoutingKey).To(Equal("second"))
+		})
+
+		It("keeps messages that are not confirmed and stops there", func() {
+			stage("first", "1")
+			stage("second", "2")
+
+			publisher.outcome = rabbit.PublishReturned
+
+			n, err := outbox.Relay(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, rabbit.ErrUnroutable)).To(BeTrue())
+			Expect(n).To(Equal(0))
+			Expect(store.len()).To(Equal(2))
+			Expect(publisher.messages()).To(HaveLen(1))
+		})
+
+		It("relays at most BatchSize messages", func() {
+			outbox.Options.BatchSize = 1
+
+			stage("first", "1")
+			stage("second", "2")
+
+			n, err := outbox.Relay(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(1))
+			Expect(store.len()).To(Equal(1))
+		})
+	})
+
+	Context("Run", func() {
+		It("relays messages until the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+				outbox.Run(ctx)
+			}()
+
+			stage("key", "body")
+
+			Eventually(store.len).Should(Equal(0))
+			Expect(publisher.messages()).To(HaveLen(1))
+
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+	})
+})
+
+type fakePublisher struct {
+	outcome   rabbit.PublishOutcome
+	published []Message
+	mutex     sync.Mutex
+}
+
+func (f *fakePublisher) PublishAndWait(_ context.Context, routingKey string, body []byte, opts ...rabbit.PublishOption) (rabbit.PublishResult, error) {
+	p := amqp.Publishing{Body: body}
+
+	for _, opt := range opts {
+		opt(&p)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.published = append(f.published, Message{RoutingKey: routingKey, Publishing: p})
+
+	result := rabbit.PublishResult{Outcome: f.outcome}
+
+	if f.outcome == rabbit.PublishReturned {
+		result.Return = &amqp.Return{ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"}
+	}
+
+	return result, nil
+}
+
+func (f *fakePublisher) messages() []Message {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]Message(nil), f.published...)
+}
+
+// A minimal database/sql driver, just enough to back the outbox queries with
+// an in-memory table.
+
+type fakeRow struct {
+	id        string
+	createdAt int64
+	message   string
+}
+
+type fakeStore struct {
+	rows    map[string]fakeRow
+	queries []string
+	mutex   sync.Mutex
+}
+
+func (s *fakeStore) len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.rows)
+}
+
+func (s *fakeStore) lastQuery() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.queries[len(s.queries)-1]
+}
+
+type fakeStoreRegistry struct {
+	stores map[string]*fakeStore
+	mutex  sync.Mutex
+}
+
+func (r *fakeStoreRegistry) get(dsn string) *fakeStore {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.stores[dsn]; !ok {
+		r.stores[dsn] = &fakeStore{rows: make(map[string]fakeRow)}
+	}
+
+	return r.stores[dsn]
+}
+
+var fakeStores = &fakeStoreRegistry{stores: make(map[string]*fakeStore)}
+
+func init() {
+	sql.Register("outbox-fake", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return &fakeConn{store: fakeStores.get(dsn)}, nil
+}
+
+type fakeConn struct {
+	store   *fakeStore
+	pending []fakeRow
+	inTx    bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.inTx = true
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	for _, row := range c.pending {
+		c.store.rows[row.id] = row
+	}
+
+	c.pending, c.inTx = nil, false
+
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending, c.inTx = nil, false
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	store := s.conn.store
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.queries = append(store.queries, s.query)
+
+	switch {
+	case strings.HasPrefix(s.query, "INSERT"):
+		row := fakeRow{id: args[0].(string), createdAt: args[1].(int64), message: args[2].(string)}
+
+		if s.conn.inTx {
+			s.conn.pending = append(s.conn.pending, row)
+		} else {
+			store.rows[row.id] = row
+		}
+	case strings.HasPrefix(s.query, "DELETE"):
+		delete(store.rows, args[0].(string))
+	default:
+		return nil, errors.New("unsupported statement")
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(_ []driver.Value) (driver.Rows, error) {
+	store := s.conn.store
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.queries = append(store.queries, s.query)
+
+	rows := make([]fakeRow, 0, len(store.rows))
+
+	for _, row := range store.rows {
+		rows = append(rows, row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].createdAt < rows[j].createdAt ||
+			(rows[i].createdAt == rows[j].createdAt && rows[i].id < rows[j].id)
+	})
+
+	// Honour the LIMIT clause
+	var limit int
+
+	if i := strings.LastIndex(s.query, "LIMIT "); i >= 0 {
+		for _, c := range s.query[i+len("LIMIT "):] {
+			limit = limit*10 + int(c-'0')
+		}
+	}
+
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	return &fakeRows{rows: rows}, nil
+}
+
+type fakeRows struct {
+	rows []fakeRow
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "message"} }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	dest[0], dest[1] = r.rows[0].id, r.rows[0].message
+	r.rows = r.rows[1:]
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrPoisonMessage is passed down the error channel when a message has been
+// delivered more than `Options.MaxDeliveryAttempts` times; it is moved to
+// `Options.ParkingQueue` (or rejected without requeueing, if unset) instead
+// of being handled.
+var ErrPoisonMessage = errors.New("message exceeded the maximum delivery attempts")
+
+// checkPoison returns an error wrapping ErrPoisonMessage if the message has
+// exceeded `Options.MaxDeliveryAttempts`, after moving it to the parking queue
+// (if any); the returned error does not wrap ErrPoisonMessage if the message
+// could not be parked, so that it is settled as a regular handler error.
+func (r *Rabbit) checkPoison(msg amqp.Delivery) error {
+	if r.Options.MaxDeliveryAttempts == 0 {
+		return nil
+	}
+
+	attempts := r.Attempts(msg)
+	if attempts <= int64(r.Options.MaxDeliveryAttempts) {
+		return nil
+	}
+
+	if r.Options.ParkingQueue != "" {
+		if err := r.park(r.ctx, msg); err != nil {
+			return fmt.Errorf("unable to move message to parking queue after %d delivery attempts: %w", attempts, err)
+		}
+	}
+
+	return fmt.Errorf("%d delivery attempts: %w", attempts, ErrPoisonMessage)
+}
+
+// park republishes the message straight to the parking queue (via the default
+// exchange).
+func (r *Rabbit) park(ctx context.Context, msg amqp.Delivery) error {
+	if err := r.ensureServerChannel(); err != nil {
+		return err
+	}
+
+	r.ProducerRWMutex.RLock()
+	defer r.ProducerRWMutex.RUnlock()
+
+	return r.ProducerServerChannel.PublishWithContext(ctx, "", r.Options.ParkingQueue, false, false, deliveryToPublishing(msg))
+}
@@ -0,0 +1,246 @@
+package rabbit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultAdaptivePrefetchMax is the highest prefetch count set by the
+	// adaptive prefetch controller, if none is provided in its options
+	DefaultAdaptivePrefetchMax = 1000
+
+	// DefaultAdaptivePrefetchInterval is how often the adaptive prefetch
+	// controller adjusts the prefetch count, if none is provided in its options
+	DefaultAdaptivePrefetchInterval = 10 * time.Second
+
+	// DefaultAdaptivePrefetchIncrease is how much the adaptive prefetch
+	// controller raises the prefetch count at a time, if none is provided in
+	// its options
+	DefaultAdaptivePrefetchIncrease = 5
+
+	// DefaultAdaptivePrefetchDecrease is the factor the adaptive prefetch
+	// controller lowers the prefetch count by, if none is provided in its
+	// options
+	DefaultAdaptivePrefetchDecrease = 0.5
+)
+
+// AdaptivePrefetch configures a controller tuning the prefetch count of the
+// consumer used by `Consume()` & co. AIMD-style, based on the handler latency
+// and the number of messages in flight observed every Interval: if the average latency exceeds
+// TargetLatency, the prefetch count is multiplied by DecreaseFactor; if it
+// does not and the handlers have been kept busy (ie. as many messages as
+// there are workers have been in flight at once), it is raised by Increase.
+// The prefetch count starts from `Options.QosPrefetchCount` and is kept
+// between Min and Max.
+//
+// Each adjustment re-subscribes the consumer on a new channel (see
+// `SetPrefetch()`); dedicated consumers (eg. `ConsumeWithConfig()`) are
+// neither measured nor re-subscribed, though the ones started afterwards
+// default to the adjusted count.
+type AdaptivePrefetch struct {
+	// Required; average handler latency the controller aims to stay below
+	TargetLatency time.Duration `json:"target_latency,omitempty" yaml:"target_latency,omitempty"`
+
+	// Lowest prefetch count; 1 if unset
+	Min int `json:"min,omitempty" yaml:"min,omitempty"`
+
+	// Highest prefetch count; DefaultAdaptivePrefetchMax if unset
+	Max int `json:"max,omitempty" yaml:"max,omitempty"`
+
+	// How often the prefetch count is adjusted (if need be); as the consumer
+	// is re-subscribed with the new count, it should not be too short.
+	// DefaultAdaptivePrefetchInterval if unset
+	Interval time.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+
+	// How much the prefetch count is raised at a time;
+	// DefaultAdaptivePrefetchIncrease if unset
+	Increase int `json:"increase,omitempty" yaml:"increase,omitempty"`
+
+	// Factor (between 0 and 1) the prefetch count is multiplied by when the
+	// latency exceeds the target; DefaultAdaptivePrefetchDecrease if unset
+	DecreaseFactor float64 `json:"decrease_factor,omitempty" yaml:"decrease_factor,omitempty"`
+}
+
+func (p *AdaptivePrefetch) validate(v *ValidationError, prefix string) {
+	if p.TargetLatency <= 0 {
+		v.add(prefix+"TargetLatency", "must be positive")
+	}
+
+	if p.Min < 0 {
+		v.add(prefix+"Min", "cannot be negative")
+	}
+
+	if p.Max < 0 {
+		v.add(prefix+"Max", "cannot be negative")
+	}
+
+	if p.Max > 0 && p.Min > p.Max {
+		v.add(prefix+"Min", "cannot be greater than Max")
+	}
+
+	if p.Interval < 0 {
+		v.add(prefix+"Interval", "cannot be negative")
+	}
+
+	if p.Increase < 0 {
+		v.add(prefix+"Increase", "cannot be negative")
+	}
+
+	if p.DecreaseFactor < 0 || p.DecreaseFactor >= 1 {
+		v.add(prefix+"DecreaseFactor", "must be between 0 and 1")
+	}
+}
+
+func (p *AdaptivePrefetch) applyDefaults() {
+	if p.Min == 0 {
+		p.Min = 1
+	}
+
+	if p.Max == 0 {
+		p.Max = DefaultAdaptivePrefetchMax
+	}
+
+	if p.Interval == 0 {
+		p.Interval = DefaultAdaptivePrefetchInterval
+	}
+
+	if p.Increase == 0 {
+		p.Increase = DefaultAdaptivePrefetchIncrease
+	}
+
+	if p.DecreaseFactor == 0 {
+		p.DecreaseFactor = DefaultAdaptivePrefetchDecrease
+	}
+}
+
+// clamp returns the prefetch count closest to count within Min and Max.
+func (p *AdaptivePrefetch) clamp(count int) int {
+	if count < p.Min {
+		return p.Min
+	}
+
+	if count > p.Max {
+		return p.Max
+	}
+
+	return count
+}
+
+// prefetchController gathers the handler latencies and in-flight counts the
+// prefetch count is adjusted on; a nil prefetchController ignores them.
+type prefetchController struct {
+	opts        *AdaptivePrefetch
+	workers     int
+	latency     time.Duration
+	handled     int
+	inFlight    int
+	maxInFlight int
+	mutex       *sync.Mutex
+}
+
+func newPrefetchController(opts *AdaptivePrefetch, workers int) *prefetchController {
+	if opts == nil {
+		return nil
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &prefetchController{
+		opts:    opts,
+		workers: workers,
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// begin records that a message is being handled.
+func (c *prefetchController) begin() {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.inFlight++
+
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+}
+
+// end records that a message has been handled in the given time.
+func (c *prefetchController) end(latency time.Duration) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.inFlight--
+	c.latency += latency
+	c.handled++
+}
+
+// next returns the prefetch count to be set, given the current one, based on
+// what has been observed since the last call; ok is false if there is no
+// reason to change it.
+func (c *prefetchController) next(current int) (count int, ok bool) {
+	c.mutex.Lock()
+	latency, handled, maxInFlight := c.latency, c.handled, c.maxInFlight
+	c.latency, c.handled, c.maxInFlight = 0, 0, c.inFlight
+	c.mutex.Unlock()
+
+	count = c.opts.clamp(current)
+
+	if handled > 0 {
+		switch {
+		case latency/time.Duration(handled) > c.opts.TargetLatency:
+			count = c.opts.clamp(int(math.Floor(float64(count) * c.opts.DecreaseFactor)))
+		case maxInFlight >= c.workers:
+			count = c.opts.clamp(count + c.opts.Increase)
+		}
+	}
+
+	return count, count != current
+}
+
+// tunePrefetch adjusts the prefetch count every `AdaptivePrefetch.Interval`
+// until the library is stopped.
+func (r *Rabbit) tunePrefetch() {
+	ticker := time.NewTicker(r.Options.AdaptivePrefetch.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			current := r.qosPrefetchCount()
+
+			count, ok := r.prefetch.next(current)
+			if !ok {
+				continue
+			}
+
+			// Cancelled by StopDrain(); must not be re-subscribed
+			if atomic.LoadInt32(&r.draining) == 1 {
+				continue
+			}
+
+			r.log.Debugf("adjusting prefetch count from %d to %d", current, count)
+
+			// Unlike SetPrefetch(), dedicated consumers are left alone
+			atomic.StoreInt64(&r.prefetchCount, int64(count))
+
+			if err := r.resubscribeMain(); err != nil {
+				r.log.Errorf("unable to adjust prefetch count: %s", err)
+			}
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+// IdempotencyKeyHeader is the header carrying the idempotency key of a
+// message (see `Options.IdempotencyKeys`); pass it to `Deduplicate()` so that
+// consumers process each key once.
+const IdempotencyKeyHeader = "x-idempotency-key"
+
+// PublishOption is used to set message properties on a per-publish basis;
+// options are applied in order on top of the library defaults (persistent
+// delivery mode and `Options.AppID`).
+type PublishOption func(p *amqp.Publishing)
+
+// WithHeaders sets the application-specific headers of the message.
+func WithHeaders(headers amqp.Table) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.Headers = headers
+	}
+}
+
+// WithContentType sets the MIME content type of the message body.
+func WithContentType(contentType string) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.ContentType = contentType
+	}
+}
+
+// WithContentEncoding sets the MIME content encoding of the message body.
+func WithContentEncoding(contentEncoding string) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.ContentEncoding = contentEncoding
+	}
+}
+
+// WithCorrelationID sets the correlation identifier of the message.
+func WithCorrelationID(correlationID string) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.CorrelationId = correlationID
+	}
+}
+
+// WithReplyTo sets the address (usually a queue name) to reply to.
+func WithReplyTo(replyTo string) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.ReplyTo = replyTo
+	}
+}
+
+// WithMessageID sets the message identifier.
+func WithMessageID(messageID string) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.MessageId = messageID
+	}
+}
+
+// WithTimestamp sets the message timestamp.
+func WithTimestamp(timestamp time.Time) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.Timestamp = timestamp
+	}
+}
+
+// WithExpiration sets the per-message TTL; the broker expects it to be
+// expressed as a string of milliseconds, which is taken care of here.
+func WithExpiration(ttl time.Duration) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.Expiration = strconv.FormatInt(ttl.Milliseconds(), 10)
+	}
+}
+
+// WithPriority sets the message priority (0 to 9).
+func WithPriority(priority uint8) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.Priority = priority
+	}
+}
+
+// WithType sets the message type name.
+func WithType(messageType string) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.Type = messageType
+	}
+}
+
+// WithDeliveryMode overrides the default (persistent) delivery mode.
+func WithDeliveryMode(deliveryMode uint8) PublishOption {
+	return func(p *amqp.Publishing) {
+		p.DeliveryMode = deliveryMode
+	}
+}
+
+// WithIdempotencyKey sets the key (see `IdempotencyKeyHeader`) consumers can
+// deduplicate the message by, eg. when retrying a publish whose outcome is
+// unknown; it is honoured even if `Options.IdempotencyKeys` is disabled.
+func WithIdempotencyKey(key string) PublishOption {
+	return func(p *amqp.Publishing) {
+		setHeader(p, IdempotencyKeyHeader, key)
+	}
+}
+
+// newPublishing assembles the message to be sent out, applying the given
+// options on top of the library defaults.
+func (r *Rabbit) newPublishing(body []byte, opts ...PublishOption) amqp.Publishing {
+	p := amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+		AppId:        r.Options.AppID,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&p)
+		}
+	}
+
+	if r.Options.IdempotencyKeys {
+		if _, ok := p.Headers[IdempotencyKeyHeader]; !ok {
+			setHeader(&p, IdempotencyKeyHeader, uuid.NewV4().String())
+		}
+	}
+
+	// Allows consumers to measure the end-to-end latency
+	if r.Options.Metrics != nil && p.Timestamp.IsZero() {
+		p.Timestamp = time.Now()
+	}
+
+	return p
+}
+
+// admitPublish makes sure that a message with a body of the given size can
+// be published as per the publish circuit breaker and rate limit (see
+// `Options.PublishBreaker` and `Options.PublishRateLimit`); trial is as per
+// `breaker.allow()` and must be reported to the breaker.
+func (r *Rabbit) admitPublish(ctx context.Context, size int) (trial bool, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	trial, err = r.publishBreaker.allow()
+	if err != nil {
+		return false, err
+	}
+
+	// Only Close() stops publishing, unlike Stop()
+	if err := r.publishLimiter.wait(ctx, r.shutdown, size); err != nil {
+		r.publishBreaker.cancel(trial)
+		return false, publishError(err)
+	}
+
+	return trial, nil
+}
+
+// PublishEncoded validates (if it implements `Validator`) and encodes `v` using
+// the given codec, then publishes it with the codec's content type.
+//
+// The content type can still be overridden via `WithContentType()`.
+func (r *Rabbit) PublishEncoded(ctx context.Context, routingKey string, v interface{}, codec Codec, opts ...PublishOption) error {
+	if codec == nil {
+		return errors.New("codec cannot be nil")
+	}
+
+	if validator, ok := v.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("payload validation failed: %w", err)
+		}
+	}
+
+	body, err := codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to encode payload: %w", err)
+	}
+
+	opts = append([]PublishOption{WithContentType(codec.ContentType())}, opts...)
+
+	return r.Publish(ctx, routingKey, body, opts...)
+}
+
+// PublishJSON is a shorthand for `PublishEncoded()` using `JSONCodec`.
+func (r *Rabbit) PublishJSON(ctx context.Context, routingKey string, v interface{}, opts ...PublishOption) error {
+	return r.PublishEncoded(ctx, routingKey, v, JSONCodec{}, opts...)
+}
+
+// setHeader sets the header on a copy of the message headers, so that the
+// table passed in by the caller is not modified.
+func setHeader(p *amqp.Publishing, key string, value interface{}) {
+	headers := make(amqp.Table, len(p.Headers)+1)
+
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+
+	headers[key] = value
+	p.Headers = headers
+}
@@ -0,0 +1,222 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned when publishing faster than
+// `Options.PublishRateLimit` allows and
+// `Options.PublishFailFastWhenRateLimited` is set, or when publishing a
+// message larger than its ByteBurst.
+var ErrRateLimited = errors.New("publish rate limit exceeded")
+
+// RateLimit configures a token bucket: messages are let through at a
+// sustained PerSecond rate, with up to Burst of them at once.
+type RateLimit struct {
+	// Required; sustained rate, in messages per second
+	PerSecond float64 `json:"per_second,omitempty" yaml:"per_second,omitempty"`
+
+	// Maximum number of messages let through at once; 1 if unset
+	Burst int `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+func (l *RateLimit) validate(v *ValidationError, prefix string) {
+	if l.PerSecond <= 0 {
+		v.add(prefix+"PerSecond", "must be positive")
+	}
+
+	if l.Burst < 0 {
+		v.add(prefix+"Burst", "cannot be negative")
+	}
+}
+
+func (l *RateLimit) applyDefaults() {
+	if l.Burst == 0 {
+		l.Burst = 1
+	}
+}
+
+// PublishRateLimit configures token buckets limiting the rate of publishing,
+// by number of messages and/or by size of their bodies; at least one of the
+// rates must be set.
+type PublishRateLimit struct {
+	// Sustained rate, in messages per second; unlimited if 0
+	MessagesPerSecond float64 `json:"messages_per_second,omitempty" yaml:"messages_per_second,omitempty"`
+
+	// Maximum number of messages published at once; 1 if unset
+	MessageBurst int `json:"message_burst,omitempty" yaml:"message_burst,omitempty"`
+
+	// Sustained rate, in bytes (of message bodies) per second; unlimited if 0
+	BytesPerSecond float64 `json:"bytes_per_second,omitempty" yaml:"bytes_per_second,omitempty"`
+
+	// Maximum number of bytes published at once, which caps the size of a
+	// message; BytesPerSecond (rounded up) if unset
+	ByteBurst int `json:"byte_burst,omitempty" yaml:"byte_burst,omitempty"`
+}
+
+func (l *PublishRateLimit) validate(v *ValidationError, prefix string) {
+	if l.MessagesPerSecond < 0 {
+		v.add(prefix+"MessagesPerSecond", "cannot be negative")
+	}
+
+	if l.BytesPerSecond < 0 {
+		v.add(prefix+"BytesPerSecond", "cannot be negative")
+	}
+
+	if l.MessagesPerSecond == 0 && l.BytesPerSecond == 0 {
+		v.add(prefix+"MessagesPerSecond", "cannot be unset along with BytesPerSecond")
+	}
+
+	if l.MessageBurst < 0 {
+		v.add(prefix+"MessageBurst", "cannot be negative")
+	}
+
+	if l.ByteBurst < 0 {
+		v.add(prefix+"ByteBurst", "cannot be negative")
+	}
+}
+
+func (l *PublishRateLimit) applyDefaults() {
+	if l.MessageBurst == 0 {
+		l.MessageBurst = 1
+	}
+
+	if l.ByteBurst == 0 {
+		l.ByteBurst = int(math.Ceil(l.BytesPerSecond))
+	}
+}
+
+// publishLimiter enforces a `PublishRateLimit`; a nil publishLimiter lets
+// everything through.
+type publishLimiter struct {
+	messages *rate.Limiter
+	bytes    *rate.Limiter
+	failFast bool
+}
+
+func newPublishLimiter(l *PublishRateLimit, failFast bool) *publishLimiter {
+	if l == nil {
+		return nil
+	}
+
+	limiter := &publishLimiter{failFast: failFast}
+
+	if l.MessagesPerSecond > 0 {
+		limiter.messages = rate.NewLimiter(rate.Limit(l.MessagesPerSecond), l.MessageBurst)
+	}
+
+	if l.BytesPerSecond > 0 {
+		limiter.bytes = rate.NewLimiter(rate.Limit(l.BytesPerSecond), l.ByteBurst)
+	}
+
+	return limiter
+}
+
+// wait waits until a message of the given size can be published, or fails
+// with ErrRateLimited if it cannot be right away and failFast is set; an
+// error is also returned if ctx is done or stop is closed first.
+func (l *publishLimiter) wait(ctx context.Context, stop <-chan struct{}, size int) error {
+	if l == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	var reservations []*rate.Reservation
+
+	cancel := func() {
+		for _, reservation := range reservations {
+			reservation.CancelAt(now)
+		}
+	}
+
+	var delay time.Duration
+
+	for _, limit := range []struct {
+		limiter *rate.Limiter
+		n       int
+	}{{l.messages, 1}, {l.bytes, size}} {
+		if limit.limiter == nil {
+			continue
+		}
+
+		reservation := limit.limiter.ReserveN(now, limit.n)
+		if !reservation.OK() {
+			cancel()
+			return fmt.Errorf("message of %d bytes exceeds the publish rate limit burst: %w", size, ErrRateLimited)
+		}
+
+		reservations = append(reservations, reservation)
+
+		if d := reservation.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+
+	if delay == 0 {
+		return nil
+	}
+
+	if l.failFast {
+		cancel()
+		return ErrRateLimited
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	case <-stop:
+		cancel()
+		return ErrShutdown
+	}
+}
+
+// newLimiter returns a limiter configured as per l (nil if l is nil).
+func newLimiter(l *RateLimit) *rate.Limiter {
+	if l == nil {
+		return nil
+	}
+
+	return rate.NewLimiter(rate.Limit(l.PerSecond), l.Burst)
+}
+
+// waitLimiter waits for the limiter (if any) to let n messages through; an
+// error is returned if ctx is done or stop is closed first.
+func waitLimiter(ctx context.Context, stop <-chan struct{}, limiter *rate.Limiter, n int) error {
+	if limiter == nil {
+		return nil
+	}
+
+	reservation := limiter.ReserveN(time.Now(), n)
+
+	delay := reservation.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	case <-stop:
+		reservation.Cancel()
+		return ErrShutdown
+	}
+}
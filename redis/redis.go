@@ -0,0 +1,135 @@
+// Package redis keeps track of processed messages in Redis, for use as the
+// `rabbit.DedupStore` of `rabbit.Deduplicate()` handlers; unlike
+// `rabbit.MemoryDedupStore`, it can be shared by multiple consumer processes.
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/batchcorp/rabbit"
+)
+
+const (
+	// DefaultPrefix is prepended to the keys stored in Redis, if no prefix is
+	// provided in the Options
+	DefaultPrefix = "rabbit:dedup:"
+
+	// DefaultTTL is how long keys are remembered for, if no TTL is provided
+	// in the Options
+	DefaultTTL = rabbit.DefaultDedupTTL
+
+	// DefaultLease is how long keys are held while messages are processed, if
+	// no lease is provided in the Options (capped at the TTL)
+	DefaultLease = rabbit.DefaultDedupLease
+)
+
+var _ rabbit.DedupStore = (*DedupStore)(nil)
+
+// Options determines how the store behaves and should be passed in via
+// `New()`.
+type Options struct {
+	// Required; eg. a *goredis.Client or *goredis.ClusterClient
+	Client goredis.UniversalClient
+
+	// Prepended to the keys stored in Redis; DefaultPrefix if unset
+	Prefix string
+
+	// How long keys are remembered for; DefaultTTL if unset
+	TTL time.Duration
+
+	// How long keys are held while messages are processed, so that they are
+	// processed again if the consumer dies mid-handler; DefaultLease (capped
+	// at TTL) if unset
+	Lease time.Duration
+}
+
+// DedupStore records message keys in Redis with an expiry; it is
+// instantiated via `New()`.
+type DedupStore struct {
+	Options *Options
+}
+
+// New is used for instantiating the store.
+func New(opts *Options) (*DedupStore, error) {
+	if err := ValidateOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return &DedupStore{
+		Options: opts,
+	}, nil
+}
+
+// ValidateOptions validates the options and applies defaults.
+func ValidateOptions(opts *Options) error {
+	if opts == nil {
+		return errors.New("Options cannot be nil")
+	}
+
+	if opts.Client == nil {
+		return errors.New("Client cannot be nil")
+	}
+
+	if opts.TTL < 0 {
+		return errors.New("TTL cannot be negative")
+	}
+
+	if opts.Lease < 0 {
+		return errors.New("Lease cannot be negative")
+	}
+
+	if opts.Lease > opts.TTL && opts.TTL != 0 {
+		return errors.New("Lease cannot be longer than TTL")
+	}
+
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+
+	if opts.TTL == 0 {
+		opts.TTL = DefaultTTL
+	}
+
+	if opts.Lease == 0 {
+		opts.Lease = DefaultLease
+		if opts.Lease > opts.TTL {
+			opts.Lease = opts.TTL
+		}
+	}
+
+	return nil
+}
+
+// Claim records the key for the lease (via SET NX), reporting false if it is
+// already recorded.
+func (s *DedupStore) Claim(ctx context.Context, key string) (bool, error) {
+	claimed, err := s.Options.Client.SetNX(ctx, s.Options.Prefix+key, time.Now().Unix(), s.Options.Lease).Result()
+	if err != nil {
+		return false, fmt.Errorf("unable to claim key: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// Commit records the key for the TTL.
+func (s *DedupStore) Commit(ctx context.Context, key string) error {
+	if err := s.Options.Client.Set(ctx, s.Options.Prefix+key, time.Now().Unix(), s.Options.TTL).Err(); err != nil {
+		return fmt.Errorf("unable to commit key: %w", err)
+	}
+
+	return nil
+}
+
+// Release deletes the key.
+func (s *DedupStore) Release(ctx context.Context, key string) error {
+	if err := s.Options.Client.Del(ctx, s.Options.Prefix+key).Err(); err != nil {
+		return fmt.Errorf("unable to release key: %w", err)
+	}
+
+	return nil
+}
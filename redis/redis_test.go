@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var _ = Describe("Redis", func() {
+	var (
+		server *miniredis.Miniredis
+		client *goredis.Client
+		store  *DedupStore
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		server, err = miniredis.Run()
+		Expect(err).ToNot(HaveOccurred())
+
+		client = goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+
+		store, err = New(&Options{Client: client, TTL: time.Minute, Lease: time.Second})
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx = context.Background()
+	})
+
+	AfterEach(func() {
+		client.Close()
+		server.Close()
+	})
+
+	It("claims keys once", func() {
+		claimed, err := store.Claim(ctx, "message-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claimed).To(BeTrue())
+
+		claimed, err = store.Claim(ctx, "message-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claimed).To(BeFalse())
+
+		Expect(server.Exists(DefaultPrefix + "message-1")).To(BeTrue())
+		Expect(server.TTL(DefaultPrefix + "message-1")).To(Equal(time.Second))
+	})
+
+	It("keeps committed keys for the TTL", func() {
+		_, err := store.Claim(ctx, "message-1")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(store.Commit(ctx, "message-1")).To(Succeed())
+		Expect(server.TTL(DefaultPrefix + "message-1")).To(Equal(time.Minute))
+
+		server.FastForward(time.Second)
+
+		claimed, err := store.Claim(ctx, "message-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claimed).To(BeFalse())
+	})
+
+	It("allows released or expired keys to be claimed again", func() {
+		_, err := store.Claim(ctx, "message-1")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(store.Release(ctx, "message-1")).To(Succeed())
+
+		claimed, err := store.Claim(ctx, "message-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claimed).To(BeTrue())
+
+		// Never committed, eg. because the consumer died mid-handler
+		server.FastForward(time.Second)
+
+		claimed, err = store.Claim(ctx, "message-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claimed).To(BeTrue())
+	})
+
+	It("errors when Redis is unavailable", func() {
+		server.Close()
+
+		_, err := store.Claim(ctx, "message-1")
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("ValidateOptions", func() {
+		It("applies defaults", func() {
+			opts := &Options{Client: client}
+
+			Expect(ValidateOptions(opts)).To(Succeed())
+			Expect(opts.Prefix).To(Equal(DefaultPrefix))
+			Expect(opts.TTL).To(Equal(DefaultTTL))
+			Expect(opts.Lease).To(Equal(DefaultLease))
+
+			opts = &Options{Client: client, TTL: time.Second}
+
+			Expect(ValidateOptions(opts)).To(Succeed())
+			Expect(opts.Lease).To(Equal(time.Second))
+		})
+
+		It("errors with missing or invalid options", func() {
+			Expect(ValidateOptions(nil)).To(MatchError("Options cannot be nil"))
+			Expect(ValidateOptions(&Options{})).To(MatchError("Client cannot be nil"))
+			Expect(ValidateOptions(&Options{Client: client, TTL: -1})).To(MatchError("TTL cannot be negative"))
+			Expect(ValidateOptions(&Options{Client: client, Lease: -1})).To(MatchError("Lease cannot be negative"))
+			Expect(ValidateOptions(&Options{Client: client, TTL: time.Second, Lease: time.Minute})).To(MatchError("Lease cannot be longer than TTL"))
+		})
+	})
+})
@@ -0,0 +1,181 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// ConsumerIdle means that the consumer has been added but not started.
+	ConsumerIdle ConsumerState = iota
+	// ConsumerRunning means that the consumer is subscribed and consuming.
+	ConsumerRunning
+	// ConsumerStopped means that the consumer has been stopped.
+	ConsumerStopped
+)
+
+// HandlerFunc is the function run on every message received by a consumer.
+type HandlerFunc func(msg amqp.Delivery) error
+
+// ConsumerState is the type used to represent the state of a named consumer.
+type ConsumerState int
+
+func (s ConsumerState) String() string {
+	switch s {
+	case ConsumerIdle:
+		return "idle"
+	case ConsumerRunning:
+		return "running"
+	case ConsumerStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("ConsumerState(%d)", int(s))
+	}
+}
+
+// ConsumerInfo describes a named consumer; see `List()`.
+type ConsumerInfo struct {
+	Name        string
+	QueueName   string
+	ConsumerTag string
+	State       ConsumerState
+}
+
+type namedConsumer struct {
+	cfg     ConsumerConfig
+	handler HandlerFunc
+	handle  *ConsumerHandle
+}
+
+// AddConsumer registers a named consumer, to be started via `StartAll()`; the
+// consumer runs on a dedicated channel (see `ConsumeWithConfig()`) and is
+// re-established automatically on reconnect.
+func (r *Rabbit) AddConsumer(name string, cfg ConsumerConfig, handler HandlerFunc) error {
+	if name == "" {
+		return errors.New("consumer name cannot be empty")
+	}
+
+	if handler == nil {
+		return errors.New("consumer handler cannot be nil")
+	}
+
+	r.namedMutex.Lock()
+	defer r.namedMutex.Unlock()
+
+	if _, ok := r.named[name]; ok {
+		return fmt.Errorf("consumer '%s' already exists", name)
+	}
+
+	r.named[name] = &namedConsumer{
+		cfg:     cfg,
+		handler: handler,
+	}
+
+	return nil
+}
+
+// StartAll starts all named consumers which are not running; errors of the
+// handlers are written to `errChan` (if not nil).
+func (r *Rabbit) StartAll(ctx context.Context, errChan chan *ConsumeError) error {
+	r.namedMutex.Lock()
+	defer r.namedMutex.Unlock()
+
+	for _, name := range r.namedConsumers() {
+		c := r.named[name]
+
+		if c.state() == ConsumerRunning {
+			continue
+		}
+
+		cfg := c.cfg
+
+		h, err := r.StartConsumer(ctx, &cfg, errChan, c.handler)
+		if err != nil {
+			return fmt.Errorf("unable to start consumer '%s': %w", name, err)
+		}
+
+		c.handle = h
+	}
+
+	return nil
+}
+
+// StopConsumer stops the named consumer, leaving the others running; it can
+// be started again via `StartAll()`.
+func (r *Rabbit) StopConsumer(name string) error {
+	r.namedMutex.Lock()
+	defer r.namedMutex.Unlock()
+
+	c, ok := r.named[name]
+	if !ok {
+		return fmt.Errorf("consumer '%s' does not exist", name)
+	}
+
+	if c.handle != nil {
+		c.handle.Stop()
+	}
+
+	return nil
+}
+
+// List returns the named consumers, sorted by name.
+func (r *Rabbit) List() []ConsumerInfo {
+	r.namedMutex.Lock()
+	defer r.namedMutex.Unlock()
+
+	infos := make([]ConsumerInfo, 0, len(r.named))
+
+	for _, name := range r.namedConsumers() {
+		c := r.named[name]
+
+		info := ConsumerInfo{
+			Name:        name,
+			QueueName:   c.cfg.QueueName,
+			ConsumerTag: c.cfg.ConsumerTag,
+			State:       c.state(),
+		}
+
+		if info.QueueName == "" {
+			info.QueueName = r.Options.QueueName
+		}
+
+		if c.handle != nil {
+			info.ConsumerTag = c.handle.Tag()
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// namedConsumers returns the names of the named consumers, sorted; callers
+// must hold `namedMutex`.
+func (r *Rabbit) namedConsumers() []string {
+	names := make([]string, 0, len(r.named))
+
+	for name := range r.named {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (c *namedConsumer) state() ConsumerState {
+	if c.handle == nil {
+		return ConsumerIdle
+	}
+
+	select {
+	case <-c.handle.Done():
+		return ConsumerStopped
+	default:
+		return ConsumerRunning
+	}
+}
@@ -0,0 +1,209 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RetryStartedHeader is the header carrying when (in milliseconds since the
+// Unix epoch) a message was first retried via the `Retry` decision.
+const RetryStartedHeader = "x-retry-started"
+
+// ErrRetryTimeExceeded is returned when a message is to be retried via the
+// `Retry` decision after `RetryPolicy.MaxElapsedTime`; it is rejected without
+// requeueing (ie. dead-lettered, if the queue is configured to do so)
+// instead.
+var ErrRetryTimeExceeded = errors.New("message has been retried for longer than allowed by the retry policy")
+
+// RetryPolicy determines how long the `Retry` decision waits before
+// republishing a message, based on how many times it has been retried (see
+// `RetryCount()`); use one of the constructors for the common backoff curves.
+//
+// The wait holds up the handler (and, unless `Options.ConsumerConcurrency` is
+// set, the consumer) for its duration; should the consumer be stopped
+// meanwhile, the message is requeued.
+type RetryPolicy struct {
+	// Delay before the first retry; no delay if 0
+	InitialInterval time.Duration `json:"initial_interval,omitempty" yaml:"initial_interval,omitempty"`
+
+	// Factor the delay is multiplied by after every retry; the delay is
+	// constant if 0 or 1
+	Multiplier float64 `json:"multiplier,omitempty" yaml:"multiplier,omitempty"`
+
+	// Upper bound of the delay; uncapped if 0
+	MaxInterval time.Duration `json:"max_interval,omitempty" yaml:"max_interval,omitempty"`
+
+	// Whether the delay is picked at random between 0 and the computed one
+	// ("full jitter"), so that failing consumers do not retry in lockstep
+	Jitter bool `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+
+	// How long a message can be retried for, since its first retry (see
+	// RetryStartedHeader); unlimited if 0
+	MaxElapsedTime time.Duration `json:"max_elapsed_time,omitempty" yaml:"max_elapsed_time,omitempty"`
+
+	// Errors (matched via `errors.Is()`) that are not worth retrying, eg.
+	// validation failures; see `Retryable()`
+	Terminal []error `json:"-" yaml:"-"`
+
+	// Optional predicate telling whether an error is worth retrying; it is
+	// consulted for the errors not matching Terminal
+	IsRetryable func(err error) bool `json:"-" yaml:"-"`
+}
+
+// ConstantRetryPolicy waits the same interval before every retry.
+func ConstantRetryPolicy(interval time.Duration) *RetryPolicy {
+	return &RetryPolicy{
+		InitialInterval: interval,
+	}
+}
+
+// ExponentialRetryPolicy waits `initial` before the first retry, multiplying
+// the delay by `multiplier` after every retry, up to `max` (uncapped if 0).
+func ExponentialRetryPolicy(initial time.Duration, multiplier float64, max time.Duration) *RetryPolicy {
+	return &RetryPolicy{
+		InitialInterval: initial,
+		Multiplier:      multiplier,
+		MaxInterval:     max,
+	}
+}
+
+// ExponentialJitterRetryPolicy is the same as `ExponentialRetryPolicy()` but
+// waits a random delay between 0 and the computed one ("full jitter").
+func ExponentialJitterRetryPolicy(initial time.Duration, multiplier float64, max time.Duration) *RetryPolicy {
+	p := ExponentialRetryPolicy(initial, multiplier, max)
+	p.Jitter = true
+
+	return p
+}
+
+// Delay returns how long to wait before the given retry (0 for the first).
+func (p *RetryPolicy) Delay(retry int64) time.Duration {
+	if p == nil || p.InitialInterval <= 0 {
+		return 0
+	}
+
+	delay := float64(p.InitialInterval)
+
+	if p.Multiplier > 1 && retry > 0 {
+		delay *= math.Pow(p.Multiplier, float64(retry))
+	}
+
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+
+	// Guard against overflowing time.Duration
+	if limit := math.Nextafter(math.MaxInt64, 0); delay > limit {
+		delay = limit
+	}
+
+	if p.Jitter {
+		delay = rand.Float64() * delay
+	}
+
+	return time.Duration(delay)
+}
+
+// Retryable reports whether the handler error is worth retrying, ie. it does
+// not match any of the Terminal errors and IsRetryable (if set) agrees; with
+// no policy, every error is. Errors caused by the message itself (eg.
+// `ErrSchemaViolation`) are never retryable.
+//
+// Messages whose handler fails with a terminal error are rejected without
+// requeueing (ie. dead-lettered, if the queue is configured to do so) under
+// the NackRequeueOnError ack policy; decision handlers can use `Decide()`.
+func (p *RetryPolicy) Retryable(err error) bool {
+	if errors.Is(err, ErrSchemaViolation) || errors.Is(err, ErrInvalidSignature) || errors.Is(err, ErrPoisonMessage) || errors.Is(err, ErrClaimCheck) {
+		return false
+	}
+
+	if p == nil {
+		return true
+	}
+
+	for _, target := range p.Terminal {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+
+	if p.IsRetryable != nil {
+		return p.IsRetryable(err)
+	}
+
+	return true
+}
+
+// Decide returns the decision for a message whose processing failed with the
+// given error: `Retry` if it is retryable (see `Retryable()`), `NackDiscard`
+// otherwise; it returns `Ack` if err is nil.
+func (p *RetryPolicy) Decide(err error) Decision {
+	if err == nil {
+		return Ack
+	}
+
+	if p.Retryable(err) {
+		return Retry
+	}
+
+	return NackDiscard
+}
+
+// expired reports whether the message has been retried for longer than
+// MaxElapsedTime.
+func (p *RetryPolicy) expired(msg amqp.Delivery) bool {
+	if p == nil || p.MaxElapsedTime <= 0 {
+		return false
+	}
+
+	started := headerInt(msg.Headers[RetryStartedHeader])
+	if started < 0 {
+		return false
+	}
+
+	return time.Since(time.UnixMilli(started)) >= p.MaxElapsedTime
+}
+
+// waitRetry waits for the delay before the next retry of the message, unless
+// ctx is done or the library is stopped first.
+func (r *Rabbit) waitRetry(ctx context.Context, msg amqp.Delivery) error {
+	delay := r.Options.RetryPolicy.Delay(RetryCount(msg))
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+}
+
+func (p *RetryPolicy) validate(v *ValidationError, prefix string) {
+	if p.InitialInterval < 0 {
+		v.add(prefix+"InitialInterval", "cannot be negative")
+	}
+
+	if p.Multiplier < 0 {
+		v.add(prefix+"Multiplier", "cannot be negative")
+	}
+
+	if p.MaxInterval < 0 {
+		v.add(prefix+"MaxInterval", "cannot be negative")
+	}
+
+	if p.MaxElapsedTime < 0 {
+		v.add(prefix+"MaxElapsedTime", "cannot be negative")
+	}
+}
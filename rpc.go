@@ -0,0 +1,212 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// DirectReplyTo is the pseudo-queue replies to `Request()` are received
+	// on (see https://www.rabbitmq.com/direct-reply-to.html).
+	DirectReplyTo = "amq.rabbitmq.reply-to"
+
+	// DefaultRequestTimeout is how long `Request()` waits for a reply if the
+	// passed in context has no deadline.
+	DefaultRequestTimeout = 30 * time.Second
+)
+
+// ErrRequestTimeout is returned by `Request()` when no reply is received
+// before the deadline of the passed in context.
+var ErrRequestTimeout = errors.New("request timed out waiting for a reply")
+
+// rpcClient receives the replies to requests sent over its channel (as
+// required by direct reply-to) and hands them to the pending requests,
+// matching them by correlation ID.
+type rpcClient struct {
+	ch      *amqp.Channel
+	pending map[string]chan amqp.Delivery
+	closed  bool
+	mutex   *sync.Mutex
+}
+
+// Request publishes a request to the configured exchange and waits for the
+// matching reply, which is returned; the request is published with a unique
+// correlation ID (overriding any set via `WithCorrelationID()`) and with
+// `DirectReplyTo` as its reply-to address. Responders can use `Reply()`.
+//
+// If ctx has no deadline, `DefaultRequestTimeout` applies; should it expire
+// first, the returned error wraps `ErrRequestTimeout`.
+func (r *Rabbit) Request(ctx context.Context, routingKey string, body []byte, opts ...PublishOption) (amqp.Delivery, error) {
+	if r.closed() {
+		return amqp.Delivery{}, ErrShutdown
+	}
+
+	if r.Options.Mode == Consumer {
+		return amqp.Delivery{}, fmt.Errorf("unable to Request - library is configured in Consumer mode: %w", ErrWrongMode)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, DefaultRequestTimeout)
+		defer cancel()
+	}
+
+	client, err := r.rpcClient()
+	if err != nil {
+		return amqp.Delivery{}, fmt.Errorf("unable to set up reply consumer: %w", err)
+	}
+
+	correlationID := uuid.NewV4().String()
+
+	replies, err := client.register(correlationID)
+	if err != nil {
+		return amqp.Delivery{}, err
+	}
+
+	defer client.unregister(correlationID)
+
+	p := r.newPublishing(body, opts...)
+	p.CorrelationId = correlationID
+	p.ReplyTo = DirectReplyTo
+	injectTraceContext(ctx, &p)
+
+	if err := r.validateSchema(routingKey, p.Headers, p.Type, p.Body); err != nil {
+		return amqp.Delivery{}, err
+	}
+
+	r.sign(&p)
+
+	if err := r.checkBody(ctx, &p); err != nil {
+		return amqp.Delivery{}, err
+	}
+
+	if err := client.ch.PublishWithContext(ctx, r.exchange, routingKey, false, false, p); err != nil {
+		return amqp.Delivery{}, fmt.Errorf("unable to publish request: %w", publishError(err))
+	}
+
+	select {
+	case reply, ok := <-replies:
+		if !ok {
+			return amqp.Delivery{}, fmt.Errorf("reply channel closed while waiting for a reply: %w", ErrNotConnected)
+		}
+
+		return reply, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return amqp.Delivery{}, withSentinel(ErrRequestTimeout, ctx.Err())
+		}
+
+		return amqp.Delivery{}, ctx.Err()
+	}
+}
+
+// Reply publishes a reply to a request received via `Request()` (or any
+// message with a reply-to address), carrying over its correlation ID.
+func (r *Rabbit) Reply(ctx context.Context, request amqp.Delivery, body []byte, opts ...PublishOption) error {
+	if request.ReplyTo == "" {
+		return errors.New("request has no reply-to address")
+	}
+
+	opts = append(opts, WithCorrelationID(request.CorrelationId))
+
+	// Replies are routed straight to the reply queue via the default exchange
+	return r.PublishTo(ctx, "", request.ReplyTo, body, opts...)
+}
+
+// rpcClient returns the client used for requests, setting up a new one if
+// there is none or if its channel has gone away (eg. on reconnect).
+func (r *Rabbit) rpcClient() (*rpcClient, error) {
+	r.rpcMutex.Lock()
+	defer r.rpcMutex.Unlock()
+
+	if r.rpc != nil && !r.rpc.ch.IsClosed() {
+		return r.rpc, nil
+	}
+
+	// Prevent using the connection while reconnecting
+	r.ProducerRWMutex.RLock()
+	defer r.ProducerRWMutex.RUnlock()
+
+	ch, err := r.Conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate channel: %w", connectionError(err))
+	}
+
+	// Direct reply-to requires no-ack consumers
+	replies, err := ch.Consume(DirectReplyTo, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("unable to consume replies: %w", connectionError(err))
+	}
+
+	r.rpc = &rpcClient{
+		ch:      ch,
+		pending: make(map[string]chan amqp.Delivery),
+		mutex:   &sync.Mutex{},
+	}
+
+	go r.rpc.dispatch(replies, r.log)
+
+	return r.rpc, nil
+}
+
+func (c *rpcClient) register(correlationID string) (<-chan amqp.Delivery, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil, fmt.Errorf("reply channel has been closed: %w", ErrNotConnected)
+	}
+
+	replies := make(chan amqp.Delivery, 1)
+	c.pending[correlationID] = replies
+
+	return replies, nil
+}
+
+func (c *rpcClient) unregister(correlationID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.pending, correlationID)
+}
+
+// dispatch hands every reply to the matching pending request until the
+// channel goes away, at which point the pending requests are failed.
+func (c *rpcClient) dispatch(replies <-chan amqp.Delivery, log Logger) {
+	for reply := range replies {
+		c.mutex.Lock()
+		pending, ok := c.pending[reply.CorrelationId]
+		delete(c.pending, reply.CorrelationId)
+		c.mutex.Unlock()
+
+		if !ok {
+			// Eg. the request has timed out already
+			log.Debugf("dropping reply with unknown correlation ID '%s'", reply.CorrelationId)
+			continue
+		}
+
+		pending <- reply
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+
+	for correlationID, pending := range c.pending {
+		close(pending)
+		delete(c.pending, correlationID)
+	}
+}
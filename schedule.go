@@ -0,0 +1,179 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Schedule controls a recurring publish started via `Every()`.
+type Schedule struct {
+	cancel func()
+	done   chan struct{}
+}
+
+// Stop stops the schedule and waits for an ongoing publish to complete. It is
+// safe to call Stop more than once.
+func (s *Schedule) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// Done returns a channel that is closed once the schedule has stopped (either
+// via `Stop()`, `Rabbit.Stop()` or `Rabbit.Close()`).
+func (s *Schedule) Done() <-chan struct{} {
+	return s.done
+}
+
+// ScheduleOption is a function that configures a schedule started via
+// `Every()`.
+type ScheduleOption func(c *scheduleConfig)
+
+type scheduleConfig struct {
+	jitter      time.Duration
+	aligned     bool
+	publishOpts []PublishOption
+	errChan     chan<- error
+}
+
+// WithJitter delays every publish by a random amount of time between 0 and
+// `jitter`, so that several instances do not publish in lockstep; delays do
+// not add up, ie. the schedule does not drift.
+func WithJitter(jitter time.Duration) ScheduleOption {
+	return func(c *scheduleConfig) {
+		c.jitter = jitter
+	}
+}
+
+// WithAlignment aligns publishes to the wall clock, ie. to the multiples of
+// the interval since the zero time (eg. on the hour, for hourly schedules),
+// rather than to when the schedule was started; this way instances started at
+// different times publish at the same, cron-like, times.
+func WithAlignment() ScheduleOption {
+	return func(c *scheduleConfig) {
+		c.aligned = true
+	}
+}
+
+// WithSchedulePublishOptions sets the options (see `PublishOption`) every
+// message of the schedule is published with.
+func WithSchedulePublishOptions(opts ...PublishOption) ScheduleOption {
+	return func(c *scheduleConfig) {
+		c.publishOpts = opts
+	}
+}
+
+// WithScheduleErrors passes the errors returned by the payload function or by
+// publishing down the given channel (on top of logging them); errors are
+// dropped if the channel is not being received from.
+func WithScheduleErrors(errChan chan<- error) ScheduleOption {
+	return func(c *scheduleConfig) {
+		c.errChan = errChan
+	}
+}
+
+// Every publishes the message returned by `payload` to the configured exchange
+// with the given routing key, once every `interval` (eg. for heartbeats or
+// periodic triggers), until the returned schedule is stopped or the library is
+// stopped or closed. The first message is published one interval from now
+// (or at the next aligned time, see `WithAlignment()`).
+//
+// Should `payload` return an error, nothing is published for that tick; like
+// publish errors, the error is logged (see also `WithScheduleErrors()`) and
+// the schedule carries on. Ticks are skipped if publishing takes longer than
+// the interval.
+func (r *Rabbit) Every(interval time.Duration, routingKey string, payload func() ([]byte, error), opts ...ScheduleOption) (*Schedule, error) {
+	if r.closed() {
+		return nil, ErrShutdown
+	}
+
+	if r.Options.Mode == Consumer {
+		return nil, fmt.Errorf("unable to schedule - library is configured in Consumer mode: %w", ErrWrongMode)
+	}
+
+	if interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+
+	if payload == nil {
+		return nil, errors.New("payload function cannot be nil")
+	}
+
+	cfg := &scheduleConfig{}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+
+	s := &Schedule{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+
+		r.runSchedule(ctx, interval, routingKey, payload, cfg)
+	}()
+
+	return s, nil
+}
+
+// runSchedule publishes at every tick of the schedule until ctx is done.
+func (r *Rabbit) runSchedule(ctx context.Context, interval time.Duration, routingKey string, payload func() ([]byte, error), cfg *scheduleConfig) {
+	next := time.Now().Add(interval)
+
+	if cfg.aligned {
+		next = time.Now().Truncate(interval).Add(interval)
+	}
+
+	for {
+		delay := time.Until(next)
+
+		if cfg.jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(cfg.jitter)))
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		if err := r.publishScheduled(ctx, routingKey, payload, cfg); err != nil && ctx.Err() == nil {
+			r.log.Errorf("unable to publish scheduled message: %s", err)
+
+			if cfg.errChan != nil {
+				select {
+				case cfg.errChan <- err:
+				default:
+				}
+			}
+		}
+
+		// Skip the ticks that have been missed meanwhile
+		now := time.Now()
+
+		for !next.After(now) {
+			next = next.Add(interval)
+		}
+	}
+}
+
+func (r *Rabbit) publishScheduled(ctx context.Context, routingKey string, payload func() ([]byte, error), cfg *scheduleConfig) error {
+	body, err := payload()
+	if err != nil {
+		return fmt.Errorf("unable to generate payload: %w", err)
+	}
+
+	return r.Publish(ctx, routingKey, body, cfg.publishOpts...)
+}
@@ -0,0 +1,43 @@
+package rabbit
+
+import (
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrSchemaViolation is returned when publishing a message that does not
+// conform to its schema (see `Options.SchemaValidator`), and passed down the
+// error channel for such consumed messages, which are rejected without
+// requeueing (ie. dead-lettered, if the queue is configured to do so).
+var ErrSchemaViolation = errors.New("message does not conform to its schema")
+
+// SchemaValidator checks message bodies against the schema registered for
+// their type or routing key; see the jsonschema package for a JSON Schema
+// implementation.
+type SchemaValidator interface {
+	// ValidateMessage returns an error if the body does not conform to the
+	// schema registered for the message type (read from the
+	// `DefaultMessageTypeHeader` header or, if absent, the `Type` property)
+	// or the routing key
+	ValidateMessage(routingKey, messageType string, body []byte) error
+}
+
+// validateSchema checks the message against its schema, if
+// `Options.SchemaValidator` is set.
+func (r *Rabbit) validateSchema(routingKey string, headers amqp.Table, messageType string, body []byte) error {
+	if r.Options.SchemaValidator == nil {
+		return nil
+	}
+
+	if v, ok := headers[DefaultMessageTypeHeader]; ok {
+		messageType = fmt.Sprintf("%v", v)
+	}
+
+	if err := r.Options.SchemaValidator.ValidateMessage(routingKey, messageType, body); err != nil {
+		return withSentinel(ErrSchemaViolation, err)
+	}
+
+	return nil
+}
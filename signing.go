@@ -0,0 +1,80 @@
+package rabbit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// SignatureHeader is the header carrying the hex-encoded HMAC-SHA256
+// signature of a message (see `Options.SigningKey`).
+const SignatureHeader = "x-signature"
+
+// ErrInvalidSignature is passed down the error channel when a consumed
+// message is not signed or its signature does not match (see
+// `Options.SigningKey`); such messages are rejected without requeueing (ie.
+// dead-lettered, if the queue is configured to do so).
+var ErrInvalidSignature = errors.New("message signature is missing or invalid")
+
+// sign stamps the signature of the message, if `Options.SigningKey` is set.
+func (r *Rabbit) sign(p *amqp.Publishing) {
+	if len(r.Options.SigningKey) == 0 {
+		return
+	}
+
+	setHeader(p, SignatureHeader, r.signature(p.Headers, p.Body))
+}
+
+// verify checks the signature of the message, if `Options.SigningKey` is
+// set.
+func (r *Rabbit) verify(msg amqp.Delivery) error {
+	if len(r.Options.SigningKey) == 0 {
+		return nil
+	}
+
+	signature, ok := msg.Headers[SignatureHeader].(string)
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	expected := r.signature(msg.Headers, msg.Body)
+
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// signature computes the HMAC-SHA256 of `Options.SignedHeaders` (absent
+// headers are told apart from empty ones) followed by the body.
+func (r *Rabbit) signature(headers amqp.Table, body []byte) string {
+	mac := hmac.New(sha256.New, r.Options.SigningKey)
+
+	for _, name := range r.Options.SignedHeaders {
+		value, ok := headers[name]
+
+		writeField(mac, name)
+
+		if ok {
+			writeField(mac, fmt.Sprint(value))
+		} else {
+			mac.Write([]byte{0})
+		}
+	}
+
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeField writes the value prefixed by its length, so that adjacent
+// fields cannot be shifted into each other.
+func writeField(h hash.Hash, value string) {
+	fmt.Fprintf(h, "%d:%s", len(value), value)
+}
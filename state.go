@@ -0,0 +1,72 @@
+package rabbit
+
+import "sync/atomic"
+
+const (
+	// StateConnected means that the connection to the server is usable.
+	StateConnected State = 0
+	// StateReconnecting means that the connection has been lost and that the
+	// library is trying to re-establish it.
+	StateReconnecting State = 1
+	// StateClosed means that `Close()` has been called; it is final.
+	StateClosed State = 2
+)
+
+// State is the type used to represent the state of the connection to the
+// server (see `State()`).
+type State int32
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateConnected:
+		return "Connected"
+	case StateReconnecting:
+		return "Reconnecting"
+	case StateClosed:
+		return "Closed"
+	}
+
+	return "Unknown"
+}
+
+// State returns the current state of the connection to the server.
+func (r *Rabbit) State() State {
+	return State(atomic.LoadInt32(&r.state))
+}
+
+func (r *Rabbit) closed() bool {
+	return r.State() == StateClosed
+}
+
+// setState moves to the given state, recording the error that caused it (if
+// any, eg. why the last reconnect attempt failed); it returns false (and does
+// nothing) once closed, as `StateClosed` is final. `connected` is created
+// when a reconnect starts and closed (waking up `WaitForConnection()`) when
+// it completes or the library is closed; `shutdown` is closed along with the
+// library, unlike `ctx` (which `Stop()` cancels too).
+func (r *Rabbit) setState(state State, err error) bool {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+
+	if r.closed() {
+		return false
+	}
+
+	atomic.StoreInt32(&r.state, int32(state))
+	r.stateErr = err
+
+	if state == StateClosed {
+		close(r.shutdown)
+	}
+
+	switch {
+	case state == StateReconnecting && r.connected == nil:
+		r.connected = make(chan struct{})
+	case state != StateReconnecting && r.connected != nil:
+		close(r.connected)
+		r.connected = nil
+	}
+
+	return true
+}
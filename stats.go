@@ -0,0 +1,81 @@
+package rabbit
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the internal counters of the library, meant for
+// lightweight debugging (see `Expvar()`); use `Options.Metrics` for exporting
+// measurements to a metrics backend.
+type Stats struct {
+	// Messages currently being handled
+	MessagesInFlight int64 `json:"messages_in_flight"`
+
+	// Messages handled, including the ones whose handler errored
+	MessagesConsumed int64 `json:"messages_consumed"`
+
+	// Messages whose handler returned an error (or panicked)
+	HandlerErrors int64 `json:"handler_errors"`
+
+	// Messages published, including the ones that failed
+	MessagesPublished int64 `json:"messages_published"`
+
+	// Publishes that returned an error
+	PublishErrors int64 `json:"publish_errors"`
+
+	// Attempts made at reconnecting to the server, successful or not
+	ReconnectAttempts int64 `json:"reconnect_attempts"`
+
+	// Successful reconnects
+	Reconnects int64 `json:"reconnects"`
+
+	// Consumers cancelled by the server (see `ErrConsumerCancelled`)
+	ServerCancels int64 `json:"server_cancels"`
+
+	// Errors not passed down the error channel (see `DroppedErrors()`)
+	DroppedErrors int64 `json:"dropped_errors"`
+
+	// Messages currently buffered while disconnected (see
+	// `Options.PublishBufferSize`)
+	BufferedPublishes int64 `json:"buffered_publishes"`
+
+	// Messages dropped because the publish buffer was full
+	DroppedPublishes int64 `json:"dropped_publishes"`
+
+	// Whether publishing is currently held back by the server
+	Blocked bool `json:"blocked"`
+
+	// See `BlockedDuration()`
+	BlockedDuration time.Duration `json:"blocked_duration"`
+}
+
+// Stats returns a snapshot of the internal counters of the library; counters
+// are not reset on reconnect.
+func (r *Rabbit) Stats() Stats {
+	return Stats{
+		MessagesInFlight:  atomic.LoadInt64(&r.inFlight),
+		MessagesConsumed:  atomic.LoadInt64(&r.consumed),
+		HandlerErrors:     atomic.LoadInt64(&r.handlerErrors),
+		MessagesPublished: atomic.LoadInt64(&r.published),
+		PublishErrors:     atomic.LoadInt64(&r.publishErrors),
+		ReconnectAttempts: atomic.LoadInt64(&r.reconnectAttempts),
+		Reconnects:        atomic.LoadInt64(&r.reconnects),
+		ServerCancels:     atomic.LoadInt64(&r.serverCancels),
+		DroppedErrors:     r.DroppedErrors(),
+		BufferedPublishes: int64(r.BufferedPublishes()),
+		DroppedPublishes:  atomic.LoadInt64(&r.droppedPublishes),
+		Blocked:           r.Blocked() || r.FlowPaused(),
+		BlockedDuration:   r.BlockedDuration(),
+	}
+}
+
+// Expvar returns a variable reporting `Stats()` as JSON, to be registered via
+// `expvar.Publish()` (eg. `expvar.Publish("rabbit", r.Expvar())`) so that the
+// counters are served on /debug/vars.
+func (r *Rabbit) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return r.Stats()
+	})
+}
@@ -0,0 +1,125 @@
+package rabbit
+
+import (
+	"context"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// QueueTypeStream is the value of the "x-queue-type" argument used to
+	// declare stream queues.
+	QueueTypeStream = "stream"
+
+	// DefaultStreamPrefetchCount is the prefetch count used when consuming from
+	// a stream if `Options.QosPrefetchCount` is not set, since the server
+	// requires one.
+	DefaultStreamPrefetchCount = 100
+
+	streamOffsetArg = "x-stream-offset"
+)
+
+var (
+	// OffsetFirst starts consuming from the first message in the stream.
+	OffsetFirst = StreamOffset{value: "first"}
+
+	// OffsetLast starts consuming from the last chunk of messages in the stream.
+	OffsetLast = StreamOffset{value: "last"}
+
+	// OffsetNext starts consuming from the next message published to the stream.
+	OffsetNext = StreamOffset{value: "next"}
+)
+
+// StreamOffset specifies where to start consuming a stream from; use one of
+// `OffsetFirst`, `OffsetLast`, `OffsetNext`, `OffsetAt()` or `OffsetSince()`.
+type StreamOffset struct {
+	value interface{}
+}
+
+// Value returns the value of the offset specification, ie. one of "first",
+// "last", "next", an int64 offset or a time.Time (nil if unset).
+func (o StreamOffset) Value() interface{} {
+	return o.value
+}
+
+// OffsetAt starts consuming from the given (numeric) offset.
+func OffsetAt(offset int64) StreamOffset {
+	return StreamOffset{value: offset}
+}
+
+// OffsetSince starts consuming from the messages published at or after the
+// given time.
+func OffsetSince(t time.Time) StreamOffset {
+	return StreamOffset{value: t}
+}
+
+// ConsumeFromOffset consumes messages from the configured stream queue
+// starting at the given offset, executing `f` for every received message.
+//
+// It uses a dedicated channel, so that the offset can be passed in as a
+// consumer argument; should the channel go away (eg. on reconnect), it
+// re-subscribes from the message following the last one it received.
+//
+// Like `Consume()`, it blocks until stopped via `ctx` or `Stop()`, and errors
+// returned by `f()` are passed down `errChan` (if not nil); an error is
+// returned only if the initial subscription fails.
+//
+// Since acks on streams are only used for flow control, messages are acked by
+// the library once `f()` returns; `f()` must not ack them.
+func (r *Rabbit) ConsumeFromOffset(ctx context.Context, offset StreamOffset, errChan chan *ConsumeError, f func(msg amqp.Delivery) error) error {
+	prefetch := r.qosPrefetchCount()
+	if prefetch == 0 {
+		prefetch = DefaultStreamPrefetchCount
+	}
+
+	cfg := r.consumerConfig(&ConsumerConfig{
+		Args: amqp.Table{streamOffsetArg: offset.value},
+		Qos:  &Qos{PrefetchCount: prefetch},
+	})
+
+	return r.consumeDedicated(ctx, cfg, errChan, func(msg amqp.Delivery) error {
+		err := r.runHandler(f, msg)
+
+		// Acks on streams only serve as flow control (messages are not
+		// removed), so the library always takes care of them
+		if ackErr := r.acks.ack(msg); ackErr != nil {
+			r.log.Errorf("unable to ack stream message: %s", ackErr)
+		}
+
+		// Re-subscribe from the following message, should the channel go away
+		if next, ok := msg.Headers[streamOffsetArg].(int64); ok {
+			cfg.Args = amqp.Table{streamOffsetArg: next + 1}
+		}
+
+		return handled(err)
+	})
+}
+
+// validateStreamQueue checks the options required by the server when
+// declaring and consuming stream queues.
+func validateStreamQueue(v *ValidationError, opts *Options) {
+	if !opts.QueueDeclare || opts.QueueArgs["x-queue-type"] != QueueTypeStream {
+		return
+	}
+
+	if !opts.QueueDurable {
+		v.add("QueueDurable", "must be set for stream queues")
+	}
+
+	if opts.QueueAutoDelete {
+		v.add("QueueAutoDelete", "cannot be set for stream queues")
+	}
+
+	if opts.QueueExclusive {
+		v.add("QueueExclusive", "cannot be set for stream queues")
+	}
+
+	if opts.AutoAck {
+		v.add("AutoAck", "cannot be set for stream queues")
+	}
+
+	if opts.Mode != Producer && opts.QosPrefetchCount == 0 {
+		v.add("QosPrefetchCount", "must be set when consuming from stream queues")
+	}
+}
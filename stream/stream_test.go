@@ -0,0 +1,205 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+	amqp10 "github.com/rabbitmq/rabbitmq-stream-go-client/pkg/amqp"
+	streams "github.com/rabbitmq/rabbitmq-stream-go-client/pkg/stream"
+
+	"github.com/batchcorp/rabbit"
+)
+
+var _ = Describe("Stream", func() {
+	Describe("backend registration", func() {
+		It("registers the stream backend", func() {
+			Expect(rabbit.Backends()).To(ContainElement(rabbit.BackendStream))
+		})
+	})
+
+	Describe("ValidateOptions", func() {
+		It("errors with nil options", func() {
+			Expect(ValidateOptions(nil)).ToNot(Succeed())
+		})
+
+		It("errors when no stream name is set", func() {
+			err := ValidateOptions(&rabbit.Options{
+				URLs: []string{"rabbitmq-stream://localhost:5552"},
+			})
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("QueueName"))
+		})
+
+		It("does not require bindings and applies defaults", func() {
+			opts := &rabbit.Options{
+				URLs:      []string{"rabbitmq-stream://localhost:5552"},
+				QueueName: "stream",
+			}
+
+			Expect(ValidateOptions(opts)).To(Succeed())
+			Expect(opts.Log).ToNot(BeNil())
+			Expect(opts.RetryReconnectSec).To(Equal(rabbit.DefaultRetryReconnectSec))
+			Expect(opts.ErrorBufferSize).To(Equal(rabbit.DefaultErrorBufferSize))
+		})
+	})
+
+	Describe("message conversion", func() {
+		It("round-trips properties, headers and routing key", func() {
+			timestamp := time.Now().Truncate(time.Millisecond)
+
+			message := toMessage("routing-key", amqp.Publishing{
+				Headers:       amqp.Table{"foo": "bar"},
+				ContentType:   "application/json",
+				CorrelationId: "correlation-id",
+				MessageId:     "message-id",
+				ReplyTo:       "reply-to",
+				Timestamp:     timestamp,
+				Type:          "type",
+				AppId:         "app-id",
+				Body:          []byte("body"),
+			})
+
+			data, err := message.MarshalBinary()
+			Expect(err).ToNot(HaveOccurred())
+
+			decoded := &amqp10.Message{}
+			Expect(decoded.UnmarshalBinary(data)).To(Succeed())
+
+			msg := toDelivery(decoded, 42)
+
+			Expect(msg.Body).To(Equal([]byte("body")))
+			Expect(msg.RoutingKey).To(Equal("routing-key"))
+			Expect(msg.ContentType).To(Equal("application/json"))
+			Expect(msg.CorrelationId).To(Equal("correlation-id"))
+			Expect(msg.MessageId).To(Equal("message-id"))
+			Expect(msg.ReplyTo).To(Equal("reply-to"))
+			Expect(msg.Timestamp.Equal(timestamp)).To(BeTrue())
+			Expect(msg.Type).To(Equal("type"))
+			Expect(msg.AppId).To(Equal("app-id"))
+			Expect(msg.Headers).To(HaveKeyWithValue("foo", "bar"))
+			Expect(msg.Headers).To(HaveKeyWithValue(OffsetHeader, int64(42)))
+		})
+	})
+
+	Describe("offset conversion", func() {
+		It("maps rabbit offsets to stream offset specifications", func() {
+			Expect(toOffsetSpecification(rabbit.OffsetFirst).String()).To(Equal("first"))
+			Expect(toOffsetSpecification(rabbit.OffsetLast).String()).To(Equal("last"))
+			Expect(toOffsetSpecification(rabbit.OffsetNext).String()).To(Equal("next"))
+			Expect(toOffsetSpecification(rabbit.StreamOffset{}).String()).To(Equal("next"))
+			Expect(toOffsetSpecification(rabbit.OffsetAt(10)).String()).To(ContainSubstring("10"))
+		})
+
+		It("resumes from the message following the last one consumed", func() {
+			s := &Stream{
+				Options: &rabbit.Options{StreamOffset: rabbit.OffsetFirst},
+				next:    -1,
+			}
+
+			Expect(s.startOffset()).To(Equal(rabbit.OffsetFirst))
+
+			s.consumed(0)
+			s.consumed(5)
+			s.consumed(3)
+
+			Expect(s.startOffset()).To(Equal(rabbit.OffsetAt(6)))
+		})
+	})
+
+	Describe("errors", func() {
+		It("are passed down the error channel as per ErrorPolicy", func() {
+			opts := &rabbit.Options{QueueName: "stream", ErrorPolicy: rabbit.ErrorsDropNewest}
+
+			s := &Stream{
+				Options:   opts,
+				errWriter: rabbit.NewErrorWriter(opts, make(chan struct{})),
+			}
+
+			errChan := make(chan *rabbit.ConsumeError, 1)
+
+			s.writeError(errChan, amqp.Delivery{}, errors.New("first"))
+			s.writeError(errChan, amqp.Delivery{}, errors.New("second"))
+
+			var consumeErr *rabbit.ConsumeError
+			Expect(errChan).To(Receive(&consumeErr))
+			Expect(consumeErr.Err).To(MatchError("first"))
+			Expect(consumeErr.Queue).To(Equal("stream"))
+			Expect(s.DroppedErrors()).To(Equal(int64(1)))
+		})
+
+		It("are delivered in order by a single goroutine when buffered", func() {
+			opts := &rabbit.Options{QueueName: "stream", ErrorBufferSize: 10}
+
+			s := &Stream{
+				Options:   opts,
+				errWriter: rabbit.NewErrorWriter(opts, make(chan struct{})),
+			}
+
+			errChan := make(chan *rabbit.ConsumeError)
+
+			for _, msg := range []string{"1", "2", "3"} {
+				s.writeError(errChan, amqp.Delivery{}, errors.New(msg))
+			}
+
+			for _, msg := range []string{"1", "2", "3"} {
+				var consumeErr *rabbit.ConsumeError
+				Eventually(errChan).Should(Receive(&consumeErr))
+				Expect(consumeErr.Err).To(MatchError(msg))
+			}
+
+			Expect(s.DroppedErrors()).To(BeZero())
+		})
+	})
+
+	Describe("confirmations", func() {
+		var s *Stream
+
+		BeforeEach(func() {
+			s = &Stream{
+				pending:      make(map[*amqp10.AMQP10]*pendingPublish),
+				pendingMutex: &sync.Mutex{},
+			}
+		})
+
+		It("hands the outcome over to the publisher waiting for it", func() {
+			producer := &streams.Producer{}
+			message := toMessage("routing-key", amqp.Publishing{Body: []byte("body")})
+
+			confirmed := s.awaitConfirmation(producer, message)
+
+			Expect(s.confirm(message, errors.New("rejected"))).To(BeTrue())
+			Expect(confirmed).To(Receive(MatchError("rejected")))
+
+			// Nobody waiting any longer
+			Expect(s.confirm(message, nil)).To(BeFalse())
+		})
+
+		It("fails the messages pending once their producer is closed", func() {
+			closed, open := &streams.Producer{}, &streams.Producer{}
+
+			abandoned := s.awaitConfirmation(closed, toMessage("", amqp.Publishing{}))
+			waiting := s.awaitConfirmation(open, toMessage("", amqp.Publishing{}))
+
+			s.abandonConfirmations(closed)
+
+			Expect(abandoned).To(Receive(MatchError(rabbit.ErrShutdown)))
+			Expect(waiting).ToNot(Receive())
+			Expect(s.pending).To(HaveLen(1))
+		})
+	})
+
+	Describe("Close", func() {
+		It("is a no-op once closed", func() {
+			s := &Stream{shutdown: 1}
+
+			Expect(s.Close()).To(Succeed())
+			Expect(s.closed()).To(BeTrue())
+			Expect(s.ConsumeOnce(nil, nil)).To(MatchError(rabbit.ErrShutdown))
+		})
+	})
+})
@@ -0,0 +1,216 @@
+package rabbit
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// DestinationQueue is the destination type of bindings to queues.
+	DestinationQueue = "queue"
+	// DestinationExchange is the destination type of exchange-to-exchange bindings.
+	DestinationExchange = "exchange"
+)
+
+// Topology describes a set of exchanges, queues and bindings to be declared
+// on the server; once applied via `Apply()`, it is automatically re-applied
+// every time the library reconnects.
+type Topology struct {
+	Exchanges []ExchangeSpec `json:"exchanges,omitempty" yaml:"exchanges,omitempty"`
+	Queues    []QueueSpec    `json:"queues,omitempty" yaml:"queues,omitempty"`
+	Bindings  []BindingSpec  `json:"bindings,omitempty" yaml:"bindings,omitempty"`
+}
+
+// ExchangeSpec describes an exchange to be declared.
+type ExchangeSpec struct {
+	// Required
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Required (valid: direct, fanout, topic, headers or any plugin type)
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	// Whether exchange should survive/persist server restarts
+	Durable bool `json:"durable,omitempty" yaml:"durable,omitempty"`
+
+	// Whether to delete exchange when its no longer used
+	AutoDelete bool `json:"auto_delete,omitempty" yaml:"auto_delete,omitempty"`
+
+	// Whether the exchange can only be published to by other exchanges
+	Internal bool `json:"internal,omitempty" yaml:"internal,omitempty"`
+
+	// Optional arguments (eg. alternate-exchange)
+	Args amqp.Table `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// QueueSpec describes a queue to be declared.
+type QueueSpec struct {
+	// Required
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Whether queue should survive/persist server restarts
+	Durable bool `json:"durable,omitempty" yaml:"durable,omitempty"`
+
+	// Whether to delete queue when its no longer used
+	AutoDelete bool `json:"auto_delete,omitempty" yaml:"auto_delete,omitempty"`
+
+	// Whether the queue can only be used by the declaring connection
+	Exclusive bool `json:"exclusive,omitempty" yaml:"exclusive,omitempty"`
+
+	// Optional arguments (eg. x-queue-type, x-max-priority, x-dead-letter-exchange)
+	Args amqp.Table `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// BindingSpec describes a binding between an exchange (the source) and a
+// queue or another exchange (the destination).
+type BindingSpec struct {
+	// Required; name of the exchange messages are routed from
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+
+	// Required; name of the queue or exchange messages are routed to
+	Destination string `json:"destination,omitempty" yaml:"destination,omitempty"`
+
+	// Either DestinationQueue (default) or DestinationExchange
+	DestinationType string `json:"destination_type,omitempty" yaml:"destination_type,omitempty"`
+
+	// Binding (routing) key
+	RoutingKey string `json:"routing_key,omitempty" yaml:"routing_key,omitempty"`
+
+	// Optional arguments (eg. x-match for headers exchanges)
+	Args amqp.Table `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// Validate checks that the topology is well formed; all the problems found
+// are reported at once by means of a `*ValidationError`.
+func (t *Topology) Validate() error {
+	v := &ValidationError{}
+
+	t.validate(v, "")
+
+	return v.errOrNil()
+}
+
+// validate records the problems found in `v`, prefixing field paths with
+// `prefix`.
+func (t *Topology) validate(v *ValidationError, prefix string) {
+	for i, e := range t.Exchanges {
+		if e.Name == "" {
+			v.add(fmt.Sprintf("%sExchanges[%d].Name", prefix, i), "cannot be empty")
+		}
+
+		if e.Type == "" {
+			v.add(fmt.Sprintf("%sExchanges[%d].Type", prefix, i), "cannot be empty")
+		}
+
+		validateDelayedType(v, fmt.Sprintf("%sExchanges[%d].Args", prefix, i), e.Type, e.Args)
+	}
+
+	for i, q := range t.Queues {
+		if q.Name == "" {
+			v.add(fmt.Sprintf("%sQueues[%d].Name", prefix, i), "cannot be empty")
+		}
+	}
+
+	for i, b := range t.Bindings {
+		if b.Source == "" {
+			v.add(fmt.Sprintf("%sBindings[%d].Source", prefix, i), "cannot be empty")
+		}
+
+		if b.Destination == "" {
+			v.add(fmt.Sprintf("%sBindings[%d].Destination", prefix, i), "cannot be empty")
+		}
+
+		switch b.DestinationType {
+		case "", DestinationQueue, DestinationExchange:
+		default:
+			v.add(fmt.Sprintf("%sBindings[%d].DestinationType", prefix, i), "is invalid ('%s')", b.DestinationType)
+		}
+	}
+}
+
+// Apply declares the topology on the server and registers it with `r`, so
+// that it is re-applied on reconnect.
+func (t *Topology) Apply(ctx context.Context, r *Rabbit) error {
+	if err := t.Validate(); err != nil {
+		return fmt.Errorf("invalid topology: %w", err)
+	}
+
+	if err := r.withChannel(ctx, t.declare); err != nil {
+		return fmt.Errorf("unable to apply topology: %w", err)
+	}
+
+	r.topologyMutex.Lock()
+	defer r.topologyMutex.Unlock()
+
+	for _, registered := range r.topologies {
+		if registered == t {
+			return nil
+		}
+	}
+
+	r.topologies = append(r.topologies, t)
+
+	return nil
+}
+
+// declare declares exchanges first, then queues and finally bindings.
+func (t *Topology) declare(ch *amqp.Channel) error {
+	for _, e := range t.Exchanges {
+		if err := ch.ExchangeDeclare(e.Name, e.Type, e.Durable, e.AutoDelete, e.Internal, false, e.Args); err != nil {
+			return fmt.Errorf("unable to declare exchange '%s': %w", e.Name, err)
+		}
+	}
+
+	for _, q := range t.Queues {
+		if _, err := ch.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.Args); err != nil {
+			return fmt.Errorf("unable to declare queue '%s': %w", q.Name, err)
+		}
+	}
+
+	for _, b := range t.Bindings {
+		var err error
+
+		if b.DestinationType == DestinationExchange {
+			err = ch.ExchangeBind(b.Destination, b.RoutingKey, b.Source, false, b.Args)
+		} else {
+			err = ch.QueueBind(b.Destination, b.RoutingKey, b.Source, false, b.Args)
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to bind '%s' to '%s': %w", b.Destination, b.Source, err)
+		}
+	}
+
+	return nil
+}
+
+// applyTopologies re-declares all the registered topologies; it is meant to
+// be called while reconnecting, with the producer/consumer locks held.
+func (r *Rabbit) applyTopologies() error {
+	r.topologyMutex.Lock()
+	defer r.topologyMutex.Unlock()
+
+	if len(r.topologies) == 0 {
+		return nil
+	}
+
+	ch, err := r.Conn.Channel()
+	if err != nil {
+		return fmt.Errorf("unable to instantiate channel: %w", err)
+	}
+
+	defer func() {
+		if !ch.IsClosed() {
+			ch.Close()
+		}
+	}()
+
+	for _, t := range r.topologies {
+		if err := t.declare(ch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
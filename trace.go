@@ -0,0 +1,131 @@
+package rabbit
+
+import (
+	"context"
+	"regexp"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// TraceParentHeader and TraceStateHeader are the headers carrying the W3C
+	// trace context (see https://www.w3.org/TR/trace-context/)
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+type traceContextKey struct{}
+
+// traceContext holds the W3C trace context of a message.
+type traceContext struct {
+	parent string
+	state  string
+}
+
+// version-traceid-parentid-flags; IDs cannot be all zeroes
+var traceParentRegexp = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// ContextWithTraceParent returns a copy of `ctx` carrying the given W3C trace
+// context, which is then stamped on the messages published with it; an
+// invalid `traceParent` is ignored.
+func ContextWithTraceParent(ctx context.Context, traceParent, traceState string) context.Context {
+	if !validTraceParent(traceParent) {
+		return ctx
+	}
+
+	return context.WithValue(ctx, traceContextKey{}, traceContext{
+		parent: traceParent,
+		state:  traceState,
+	})
+}
+
+// TraceParentFromContext returns the W3C trace context carried by `ctx`, if
+// any (see `ContextWithTraceParent()` and `ContextFromDelivery()`).
+func TraceParentFromContext(ctx context.Context) (traceParent, traceState string, ok bool) {
+	if ctx == nil {
+		return "", "", false
+	}
+
+	tc, ok := ctx.Value(traceContextKey{}).(traceContext)
+
+	return tc.parent, tc.state, ok
+}
+
+// ContextFromDelivery returns a copy of `ctx` carrying the W3C trace context
+// and the correlation ID of the given message (if any), so that they are
+// propagated to the messages published with it; this way the trace and the
+// request correlation survive hops through the broker.
+func ContextFromDelivery(ctx context.Context, msg amqp.Delivery) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	traceParent, traceState := traceHeaders(msg.Headers)
+
+	ctx = ContextWithTraceParent(ctx, traceParent, traceState)
+
+	return ContextWithCorrelationID(ctx, msg.CorrelationId)
+}
+
+// WithTraceFrom copies the W3C trace context of the given (incoming) message
+// into the message being published.
+func WithTraceFrom(msg amqp.Delivery) PublishOption {
+	traceParent, traceState := traceHeaders(msg.Headers)
+
+	return func(p *amqp.Publishing) {
+		setTraceHeaders(p, traceParent, traceState)
+	}
+}
+
+// injectTraceContext stamps the trace context carried by `ctx` on the message,
+// unless the message already carries one.
+func injectTraceContext(ctx context.Context, p *amqp.Publishing) {
+	if _, ok := p.Headers[TraceParentHeader]; ok {
+		return
+	}
+
+	if traceParent, traceState, ok := TraceParentFromContext(ctx); ok {
+		setTraceHeaders(p, traceParent, traceState)
+	}
+}
+
+func setTraceHeaders(p *amqp.Publishing, traceParent, traceState string) {
+	if !validTraceParent(traceParent) {
+		return
+	}
+
+	// Headers may have been passed in via WithHeaders(), so don't modify them
+	headers := make(amqp.Table, len(p.Headers)+2)
+
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+
+	headers[TraceParentHeader] = traceParent
+
+	if traceState != "" {
+		headers[TraceStateHeader] = traceState
+	} else {
+		delete(headers, TraceStateHeader)
+	}
+
+	p.Headers = headers
+}
+
+func traceHeaders(headers amqp.Table) (traceParent, traceState string) {
+	traceParent, _ = headers[TraceParentHeader].(string)
+	traceState, _ = headers[TraceStateHeader].(string)
+
+	return traceParent, traceState
+}
+
+func validTraceParent(traceParent string) bool {
+	if !traceParentRegexp.MatchString(traceParent) {
+		return false
+	}
+
+	// Version ff is invalid, as are all-zero trace and parent IDs
+	return traceParent[:2] != "ff" &&
+		traceParent[3:35] != "00000000000000000000000000000000" &&
+		traceParent[36:52] != "0000000000000000"
+}
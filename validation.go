@@ -0,0 +1,55 @@
+package rabbit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes a single problem found while validating options.
+type FieldError struct {
+	// Path of the offending field (eg. "Bindings[1].ExchangeType")
+	Field string
+
+	// What is wrong with the field (eg. "cannot be empty")
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ValidationError is returned by `ValidateOptions()` and `Topology.Validate()`
+// and holds every problem found, rather than just the first one; use
+// `errors.As()` to retrieve it from the errors returned by `New()`.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// add records a problem with the given field.
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// errOrNil returns `e` if any problem has been recorded, nil otherwise (so
+// that callers do not end up with a non-nil error interface holding no
+// problems).
+func (e *ValidationError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
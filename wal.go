@@ -0,0 +1,198 @@
+package rabbit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// WAL is a write-ahead log messages published via `PublishAsync()` (or
+// `PublishAndWait()`) are persisted to before being sent, and removed from
+// once the server has confirmed them; messages still in the log on
+// instantiation (eg. because the process crashed, or because they were
+// nacked) are published again by `New()`. See `FileWAL` for a file-based
+// implementation.
+//
+// Messages published via `Publish()` are not confirmed and thus not logged.
+type WAL interface {
+	// Append persists the entry and returns the ID to remove it by
+	Append(entry WALEntry) (string, error)
+
+	// Remove deletes the entry with the given ID
+	Remove(id string) error
+
+	// Entries returns the persisted entries (with their ID set) in the order
+	// they were appended
+	Entries() ([]WALEntry, error)
+}
+
+// WALEntry is a message persisted to the `WAL`.
+type WALEntry struct {
+	ID         string          `json:"-"`
+	Exchange   string          `json:"exchange"`
+	RoutingKey string          `json:"routing_key"`
+	Publishing amqp.Publishing `json:"publishing"`
+}
+
+var _ WAL = (*FileWAL)(nil)
+
+// FileWAL is a `WAL` storing every entry as a JSON file in a directory; files
+// are synced to disk before `Append()` returns. Header values are persisted
+// as JSON, so integers are restored as int64 and binary values (as well as
+// timestamps) as strings.
+type FileWAL struct {
+	dir string
+	seq uint64
+}
+
+// NewFileWAL returns a `FileWAL` storing entries in the given directory,
+// which is created if it does not exist.
+func NewFileWAL(dir string) (*FileWAL, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("WAL directory cannot be empty")
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create WAL directory: %w", err)
+	}
+
+	return &FileWAL{dir: dir}, nil
+}
+
+// Append writes the entry to a temporary file which, once synced, is renamed
+// into place, so that partially written entries are never replayed.
+func (w *FileWAL) Append(entry WALEntry) (string, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode WAL entry: %w", err)
+	}
+
+	// Sortable by append order, and unique within (and across) processes
+	id := fmt.Sprintf("%020d-%010d-%d", time.Now().UnixNano(), atomic.AddUint64(&w.seq, 1), os.Getpid())
+
+	tmp, err := os.CreateTemp(w.dir, ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("unable to create WAL entry: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("unable to write WAL entry: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("unable to sync WAL entry: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("unable to close WAL entry: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), w.path(id)); err != nil {
+		return "", fmt.Errorf("unable to commit WAL entry: %w", err)
+	}
+
+	return id, nil
+}
+
+// Remove deletes the file of the entry with the given ID.
+func (w *FileWAL) Remove(id string) error {
+	if err := os.Remove(w.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove WAL entry: %w", err)
+	}
+
+	return nil
+}
+
+// Entries reads the entries from the directory, ignoring temporary files.
+func (w *FileWAL) Entries() ([]WALEntry, error) {
+	files, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read WAL directory: %w", err)
+	}
+
+	var ids []string
+
+	for _, f := range files {
+		if name := f.Name(); !f.IsDir() && strings.HasSuffix(name, ".json") {
+			ids = append(ids, strings.TrimSuffix(name, ".json"))
+		}
+	}
+
+	sort.Strings(ids)
+
+	entries := make([]WALEntry, 0, len(ids))
+
+	for _, id := range ids {
+		data, err := os.ReadFile(w.path(id))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read WAL entry '%s': %w", id, err)
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		var entry WALEntry
+
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("unable to decode WAL entry '%s': %w", id, err)
+		}
+
+		entry.ID = id
+		entry.Publishing.Headers = normalizeTable(entry.Publishing.Headers)
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (w *FileWAL) path(id string) string {
+	return filepath.Join(w.dir, id+".json")
+}
+
+// replayWAL publishes the messages left in `Options.WAL` (without waiting for
+// them to be confirmed); they are removed from it once confirmed.
+func (r *Rabbit) replayWAL() error {
+	entries, err := r.Options.WAL.Entries()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, err := r.publishConfirmed(r.ctx, entry.Exchange, entry.RoutingKey, entry.Publishing, entry.ID, false); err != nil {
+			return fmt.Errorf("unable to publish entry '%s': %w", entry.ID, err)
+		}
+	}
+
+	if len(entries) > 0 {
+		r.log.Debugf("replayed %d message(s) from the WAL", len(entries))
+	}
+
+	return nil
+}
+
+// settleWAL removes the message from `Options.WAL` once the server has taken
+// responsibility for it (returned messages included, as publishing them
+// again would not help); nacked messages, and those whose channel went away,
+// are kept and replayed on instantiation.
+func (r *Rabbit) settleWAL(c *Confirmation) {
+	if c.walID == "" || c.err != nil || c.result.Outcome == PublishNacked {
+		return
+	}
+
+	if err := r.Options.WAL.Remove(c.walID); err != nil {
+		r.log.Errorf("unable to remove message from WAL: %s", err)
+	}
+}